@@ -0,0 +1,139 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// diagnosticsCache holds the last diagnostics of InfluxDB instance, diagnostics are constant
+// during running the influxdb process, so they are re-queried only when they expire or the process restarts;
+// it also counts detected restarts of the process
+type diagnosticsCache struct {
+	sync.Mutex
+	metrics []plugin.Metric
+	fetched time.Time
+	// pid and started identify the influxdb process the diagnostics were gathered from
+	pid     interface{}
+	started interface{}
+	// totalAlloc is the last observed runtime statistic TotalAlloc, it never decreases unless the process restarts
+	totalAlloc int64
+	// stale is set when restart has been detected from statistics and cached diagnostics come from the old process
+	stale bool
+	// restarts is the number of detected restarts, reset is set since detection of restart until it is reported
+	restarts int64
+	reset    bool
+	// buildVersion is the version of running InfluxDB (diagn/build/Version), empty when unknown
+	buildVersion string
+}
+
+// get returns cached diagnostics and the time they were fetched at when they are not older than `ttl`
+// and the process has not restarted
+func (c *diagnosticsCache) get(ttl time.Duration) ([]plugin.Metric, time.Time, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if ttl <= 0 || c.metrics == nil || c.stale || time.Since(c.fetched) >= ttl {
+		return nil, time.Time{}, false
+	}
+	return c.metrics, c.fetched, true
+}
+
+// set stores diagnostics `mts`, returns true when they come from other process than previously cached ones
+func (c *diagnosticsCache) set(mts []plugin.Metric) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	pid, started := systemDiagnostic(mts, "PID"), systemDiagnostic(mts, "started")
+	// restart already detected from statistics is not counted again
+	restarted := c.metrics != nil && (pid != c.pid || started != c.started) && !c.stale
+	if restarted {
+		c.restart()
+	}
+
+	c.metrics = mts
+	c.fetched = time.Now()
+	c.pid, c.started = pid, started
+	c.buildVersion, _ = diagnostic(mts, "build", "Version").(string)
+	c.stale = false
+	return restarted
+}
+
+// version returns version of InfluxDB reported by the last diagnostics, empty when unknown
+func (c *diagnosticsCache) version() string {
+	c.Lock()
+	defer c.Unlock()
+	return c.buildVersion
+}
+
+// observeTotalAlloc records runtime statistic TotalAlloc, returns true when it decreased,
+// which means the process restarted and cached diagnostics are invalidated
+func (c *diagnosticsCache) observeTotalAlloc(totalAlloc int64) bool {
+	c.Lock()
+	defer c.Unlock()
+	restarted := totalAlloc < c.totalAlloc
+	if restarted {
+		c.restart()
+		c.stale = true
+	}
+	c.totalAlloc = totalAlloc
+	return restarted
+}
+
+// restart counts restart of the process, the caller must hold the lock
+func (c *diagnosticsCache) restart() {
+	c.restarts++
+	c.reset = true
+	// TotalAlloc of new process is not compared with the old one
+	c.totalAlloc = 0
+	// InfluxDB might have been upgraded
+	c.buildVersion = ""
+}
+
+// resetDetected checks if restart has been detected and not reported yet,
+// samples of counters collected after restart are not used to compute their rates
+func (c *diagnosticsCache) resetDetected() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.reset
+}
+
+// reportRestarts returns the number of detected restarts and whether any of them has been detected
+// since the previous report
+func (c *diagnosticsCache) reportRestarts() (int64, bool) {
+	c.Lock()
+	defer c.Unlock()
+	reset := c.reset
+	c.reset = false
+	return c.restarts, reset
+}
+
+// systemDiagnostic returns value of diagnostic `system/<column>` found in `mts`
+func systemDiagnostic(mts []plugin.Metric, column string) interface{} {
+	return diagnostic(mts, "system", column)
+}
+
+// diagnostic returns value of diagnostic `<module>/<column>` found in `mts`
+func diagnostic(mts []plugin.Metric, module string, column string) interface{} {
+	for _, mt := range mts {
+		ns := mt.Namespace.Strings()
+		if len(ns) == 5 && ns[2] == nsTypeDiagn && ns[3] == module && ns[4] == column {
+			return mt.Data
+		}
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"strings"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// modes of discovering metric types (catalog_mode)
+const (
+	// catalogLive discovers metrics by querying InfluxDB
+	catalogLive = "live"
+	// catalogStatic returns metrics listed in the built-in catalog without querying InfluxDB
+	catalogStatic = "static"
+	// catalogMerged returns metrics discovered from InfluxDB together with the built-in catalog,
+	// the catalog alone is returned when InfluxDB cannot be queried
+	catalogMerged = "merged"
+)
+
+// units of metrics
+const (
+	unitNone    = ""
+	unitBytes   = "bytes"
+	unitCount   = "count"
+	unitNs      = "ns"
+	unitMs      = "ms"
+	unitSeconds = "s"
+)
+
+// data types of metrics
+const (
+	typeInt    = "int"
+	typeFloat  = "float64"
+	typeString = "string"
+	typeBool   = "bool"
+)
+
+// metricKind tells how the value of a metric changes over time
+type metricKind int
+
+const (
+	// kindGauge is a value which can go up and down
+	kindGauge metricKind = iota
+	// kindCounter is a cumulative value which only increases, unless it is reset
+	kindCounter
+)
+
+// catalogEntry describes a known metric, module of metrics of collector is the source they describe or empty
+type catalogEntry struct {
+	nsType      string
+	module      string
+	name        string
+	dataType    string
+	unit        string
+	kind        metricKind
+	description string
+}
+
+// catalog lists known metrics of InfluxDB with their descriptions, units and semantics
+var catalog = append([]catalogEntry{
+	{nsTypeDiagn, "build", "Branch", typeString, unitNone, kindGauge, "the branch name"},
+	{nsTypeDiagn, "build", "Build Time", typeString, unitNone, kindGauge, "the build time"},
+	{nsTypeDiagn, "build", "Commit", typeString, unitNone, kindGauge, "the commit"},
+	{nsTypeDiagn, "build", "Version", typeString, unitNone, kindGauge, "the InfluxDB version"},
+	{nsTypeDiagn, "network", "hostname", typeString, unitNone, kindGauge, "the InfluxDB host name"},
+	{nsTypeDiagn, "runtime", "GOARCH", typeString, unitNone, kindGauge, "the target architecture"},
+	{nsTypeDiagn, "runtime", "GOMAXPROCS", typeInt, unitCount, kindGauge, "the maximum number of CPUs that can be executing simultaneously"},
+	{nsTypeDiagn, "runtime", "GOOS", typeString, unitNone, kindGauge, "the target operating system"},
+	{nsTypeDiagn, "runtime", "version", typeString, unitNone, kindGauge, "the Go tree's version"},
+	{nsTypeDiagn, "system", "PID", typeInt, unitNone, kindGauge, "the process id"},
+	{nsTypeDiagn, "system", "currentTime", typeString, unitNone, kindGauge, "the current local time"},
+	{nsTypeDiagn, "system", "started", typeString, unitNone, kindGauge, "the started time"},
+	{nsTypeDiagn, "system", "uptime", typeString, unitNone, kindGauge, "the uptime"},
+	{nsTypeDiagn, "system", "uptime_seconds", typeFloat, unitSeconds, kindGauge, "the uptime in seconds"},
+	{nsTypeDiagn, "system", "started_unix", typeInt, unitSeconds, kindGauge, "the started time as unix timestamp"},
+	{nsTypeDiagn, "system", "clock_skew_seconds", typeFloat, unitSeconds, kindGauge, "the difference between the current time of InfluxDB and the time of collector host"},
+
+	{nsTypeCollector, "", "errors", typeInt, unitCount, kindGauge, "the number of queries to the InfluxDB instance which failed during the last collection"},
+	{nsTypeCollector, "", "restarts", typeInt, unitCount, kindCounter, "the number of restarts of the InfluxDB instance detected since the plugin started"},
+	{nsTypeCollector, "", "counter_reset", typeBool, unitNone, kindGauge, "whether restart of the InfluxDB instance has been detected since the previous collection"},
+	{nsTypeCollector, "", "up", typeInt, unitNone, kindGauge, "1 when none of queries to the InfluxDB instance failed during the last collection, 0 otherwise"},
+	{nsTypeCollector, "", "consecutive_failures", typeInt, unitCount, kindGauge, "the number of consecutive collections from the InfluxDB instance with failed queries"},
+	{nsTypeCollector, sourcePing, "reachable", typeInt, unitNone, kindGauge, "1 when the InfluxDB instance responded to the last ping, 0 otherwise"},
+	{nsTypeCollector, sourcePing, "latency_seconds", typeFloat, unitSeconds, kindGauge, "the round-trip time of the last ping"},
+	{nsTypeCollector, sourcePing, "version", typeString, unitNone, kindGauge, "the InfluxDB version reported in response to the last ping"},
+	{nsTypeCollector, sourcePing, "build", typeString, unitNone, kindGauge, "the InfluxDB build (e.g. OSS) reported in response to the last ping"},
+	{nsTypeCollector, "", "last_success_unix", typeInt, unitSeconds, kindGauge, "the time of the last collection from the InfluxDB instance without failed queries as unix timestamp"},
+
+	{nsTypeStats, "cq", "queryFail", typeInt, unitCount, kindCounter, "the number of continuous queries which failed"},
+	{nsTypeStats, "cq", "queryOk", typeInt, unitCount, kindCounter, "the number of continuous queries executed successfully"},
+
+	{nsTypeStats, "database", "numMeasurements", typeInt, unitCount, kindGauge, "the number of measurements in database"},
+	{nsTypeStats, "database", "numSeries", typeInt, unitCount, kindGauge, "the number of series in database"},
+
+	{nsTypeStats, "engine", "blksWrite", typeInt, unitCount, kindCounter, "the number of written blocks into database engine"},
+	{nsTypeStats, "engine", "blksWriteBytes", typeInt, unitBytes, kindCounter, "sum of blocks written into database engine"},
+	{nsTypeStats, "engine", "blksWriteBytesC", typeInt, unitBytes, kindCounter, "sum of compressed blocks written into database engine"},
+	{nsTypeStats, "engine", "pointsWrite", typeInt, unitCount, kindCounter, "the number of written points into database engine"},
+	{nsTypeStats, "engine", "pointsWriteDedupe", typeInt, unitCount, kindCounter, "the number of written deduplicated points into database engine"},
+
+	{nsTypeStats, "httpd", "authFail", typeInt, unitCount, kindCounter, "the number of authentication failures"},
+	{nsTypeStats, "httpd", "clientError", typeInt, unitCount, kindCounter, "the number of requests which failed due to client error"},
+	{nsTypeStats, "httpd", "pingReq", typeInt, unitCount, kindCounter, "the number of ping requests served"},
+	{nsTypeStats, "httpd", "pointsWrittenDropped", typeInt, unitCount, kindCounter, "the number of points dropped by the storage engine"},
+	{nsTypeStats, "httpd", "pointsWrittenFail", typeInt, unitCount, kindCounter, "the number of points that failed to be written"},
+	{nsTypeStats, "httpd", "pointsWrittenOK", typeInt, unitCount, kindCounter, "the number of points written successfully"},
+	{nsTypeStats, "httpd", "queryReq", typeInt, unitCount, kindCounter, "the number of query requests served"},
+	{nsTypeStats, "httpd", "queryReqDurationNs", typeInt, unitNs, kindCounter, "the total time spent serving query requests"},
+	{nsTypeStats, "httpd", "queryRespBytes", typeInt, unitBytes, kindCounter, "the sum of all bytes returned in query responses"},
+	{nsTypeStats, "httpd", "req", typeInt, unitCount, kindCounter, "the number of HTTP requests served"},
+	{nsTypeStats, "httpd", "reqActive", typeInt, unitCount, kindGauge, "the number of HTTP requests being served"},
+	{nsTypeStats, "httpd", "reqDurationNs", typeInt, unitNs, kindCounter, "the total time spent serving HTTP requests"},
+	{nsTypeStats, "httpd", "serverError", typeInt, unitCount, kindCounter, "the number of requests which failed due to server error"},
+	{nsTypeStats, "httpd", "statusReq", typeInt, unitCount, kindCounter, "the number of status requests served"},
+	{nsTypeStats, "httpd", "writeReq", typeInt, unitCount, kindCounter, "the number of write requests served"},
+	{nsTypeStats, "httpd", "writeReqActive", typeInt, unitCount, kindGauge, "the number of write requests being served"},
+	{nsTypeStats, "httpd", "writeReqBytes", typeInt, unitBytes, kindCounter, "the sum of all bytes in write requests"},
+	{nsTypeStats, "httpd", "writeReqDurationNs", typeInt, unitNs, kindCounter, "the total time spent serving write requests"},
+
+	{nsTypeStats, moduleMemstats, "Alloc", typeInt, unitBytes, kindGauge, "bytes of allocated heap objects"},
+	{nsTypeStats, moduleMemstats, "BuckHashSys", typeInt, unitBytes, kindGauge, "bytes of memory in profiling bucket hash tables"},
+	{nsTypeStats, moduleMemstats, "DebugGC", typeBool, unitNone, kindGauge, "whether debugging of garbage collector is enabled"},
+	{nsTypeStats, moduleMemstats, "EnableGC", typeBool, unitNone, kindGauge, "whether garbage collector is enabled"},
+	{nsTypeStats, moduleMemstats, "Frees", typeInt, unitCount, kindCounter, "the number of heap objects freed"},
+	{nsTypeStats, moduleMemstats, "GCCPUFraction", typeFloat, unitNone, kindGauge, "the fraction of available CPU time used by garbage collector since the process started"},
+	{nsTypeStats, moduleMemstats, "GCSys", typeInt, unitBytes, kindGauge, "bytes of memory in garbage collection metadata"},
+	{nsTypeStats, moduleMemstats, "HeapAlloc", typeInt, unitBytes, kindGauge, "bytes of allocated heap objects"},
+	{nsTypeStats, moduleMemstats, "HeapIdle", typeInt, unitBytes, kindGauge, "bytes in idle (unused) heap spans"},
+	{nsTypeStats, moduleMemstats, "HeapInuse", typeInt, unitBytes, kindGauge, "bytes in in-use heap spans"},
+	{nsTypeStats, moduleMemstats, "HeapObjects", typeInt, unitCount, kindGauge, "the number of allocated heap objects"},
+	{nsTypeStats, moduleMemstats, "HeapReleased", typeInt, unitBytes, kindGauge, "bytes of physical memory returned to the OS"},
+	{nsTypeStats, moduleMemstats, "HeapSys", typeInt, unitBytes, kindGauge, "bytes of heap memory obtained from the OS"},
+	{nsTypeStats, moduleMemstats, "LastGC", typeInt, unitNs, kindGauge, "the time the last garbage collection finished as unix timestamp in nanoseconds"},
+	{nsTypeStats, moduleMemstats, "Lookups", typeInt, unitCount, kindCounter, "the number of pointer lookups"},
+	{nsTypeStats, moduleMemstats, "MCacheInuse", typeInt, unitBytes, kindGauge, "bytes of allocated mcache structures"},
+	{nsTypeStats, moduleMemstats, "MCacheSys", typeInt, unitBytes, kindGauge, "bytes of memory obtained from the OS for mcache structures"},
+	{nsTypeStats, moduleMemstats, "MSpanInuse", typeInt, unitBytes, kindGauge, "bytes of allocated mspan structures"},
+	{nsTypeStats, moduleMemstats, "MSpanSys", typeInt, unitBytes, kindGauge, "bytes of memory obtained from the OS for mspan structures"},
+	{nsTypeStats, moduleMemstats, "Mallocs", typeInt, unitCount, kindCounter, "the number of heap objects allocated"},
+	{nsTypeStats, moduleMemstats, "NextGC", typeInt, unitBytes, kindGauge, "the target heap size of the next garbage collection"},
+	{nsTypeStats, moduleMemstats, "NumForcedGC", typeInt, unitCount, kindCounter, "the number of garbage collections forced by the application"},
+	{nsTypeStats, moduleMemstats, "NumGC", typeInt, unitCount, kindCounter, "the number of completed garbage collections"},
+	{nsTypeStats, moduleMemstats, "OtherSys", typeInt, unitBytes, kindGauge, "bytes of memory in miscellaneous off-heap runtime allocations"},
+	{nsTypeStats, moduleMemstats, "PauseNsLast", typeInt, unitNs, kindGauge, "the duration of the last garbage collector pause"},
+	{nsTypeStats, moduleMemstats, "PauseNsMax", typeInt, unitNs, kindGauge, "the longest of the recent (up to 256) garbage collector pauses"},
+	{nsTypeStats, moduleMemstats, "PauseNsP50", typeInt, unitNs, kindGauge, "the median duration of the recent (up to 256) garbage collector pauses"},
+	{nsTypeStats, moduleMemstats, "PauseNsP90", typeInt, unitNs, kindGauge, "the 90th percentile of durations of the recent (up to 256) garbage collector pauses"},
+	{nsTypeStats, moduleMemstats, "PauseNsP99", typeInt, unitNs, kindGauge, "the 99th percentile of durations of the recent (up to 256) garbage collector pauses"},
+	{nsTypeStats, moduleMemstats, "PauseTotalNs", typeInt, unitNs, kindCounter, "the total time of garbage collector pauses"},
+	{nsTypeStats, moduleMemstats, "StackInuse", typeInt, unitBytes, kindGauge, "bytes in stack spans"},
+	{nsTypeStats, moduleMemstats, "StackSys", typeInt, unitBytes, kindGauge, "bytes of stack memory obtained from the OS"},
+	{nsTypeStats, moduleMemstats, "Sys", typeInt, unitBytes, kindGauge, "bytes of memory obtained from the OS"},
+	{nsTypeStats, moduleMemstats, "TotalAlloc", typeInt, unitBytes, kindCounter, "bytes allocated for heap objects (even if freed)"},
+
+	{nsTypeStats, "queryExecutor", "queriesActive", typeInt, unitCount, kindGauge, "the number of queries being executed"},
+	{nsTypeStats, "queryExecutor", "queriesExecuted", typeInt, unitCount, kindCounter, "the number of queries started"},
+	{nsTypeStats, "queryExecutor", "queriesFinished", typeInt, unitCount, kindCounter, "the number of queries finished"},
+	{nsTypeStats, "queryExecutor", "queryDurationNs", typeInt, unitNs, kindCounter, "the total time spent executing queries"},
+
+	{nsTypeStats, "runtime", "Alloc", typeInt, unitBytes, kindGauge, "bytes of the memory allocated and not yet freed"},
+	{nsTypeStats, "runtime", "Frees", typeInt, unitCount, kindCounter, "the number of frees"},
+	{nsTypeStats, "runtime", "HeapAlloc", typeInt, unitBytes, kindGauge, "bytes of the heap space allocated and not yet freed"},
+	{nsTypeStats, "runtime", "HeapIdle", typeInt, unitBytes, kindGauge, "bytes of the heap space in idle spans"},
+	{nsTypeStats, "runtime", "HeapInUse", typeInt, unitBytes, kindGauge, "bytes of the heap space in non-idle spans"},
+	{nsTypeStats, "runtime", "HeapObjects", typeInt, unitCount, kindGauge, "total number of allocated objects on the heap"},
+	{nsTypeStats, "runtime", "HeapReleased", typeInt, unitBytes, kindGauge, "bytes of the heap space released to the OS"},
+	{nsTypeStats, "runtime", "HeapSys", typeInt, unitBytes, kindGauge, "bytes of the heap space obtained from system"},
+	{nsTypeStats, "runtime", "Lookups", typeInt, unitCount, kindCounter, "the number of pointer lookups"},
+	{nsTypeStats, "runtime", "Mallocs", typeInt, unitCount, kindCounter, "the number of mallocs"},
+	{nsTypeStats, "runtime", "NumGC", typeInt, unitCount, kindCounter, "the number of completed garbage collections"},
+	{nsTypeStats, "runtime", "NumGoroutine", typeInt, unitCount, kindGauge, "the number of goroutines that currently exist"},
+	{nsTypeStats, "runtime", "PauseTotalNs", typeInt, unitNs, kindCounter, "the total time of garbage collector pauses"},
+	{nsTypeStats, "runtime", "Sys", typeInt, unitBytes, kindGauge, "bytes of the memory obtained from system"},
+	{nsTypeStats, "runtime", "TotalAlloc", typeInt, unitBytes, kindCounter, "bytes of the memory allocated (even if freed)"},
+
+	{nsTypeStats, "shard", "diskBytes", typeInt, unitBytes, kindGauge, "the size of shard on disk"},
+	{nsTypeStats, "shard", "fieldsCreate", typeInt, unitCount, kindCounter, "the number of created fields for shard space"},
+	{nsTypeStats, "shard", "seriesCreate", typeInt, unitCount, kindCounter, "the number of created series for shard space"},
+	{nsTypeStats, "shard", "writeBytes", typeInt, unitBytes, kindCounter, "the sum of bytes written into shard"},
+	{nsTypeStats, "shard", "writePointsDropped", typeInt, unitCount, kindCounter, "the number of points dropped by shard"},
+	{nsTypeStats, "shard", "writePointsErr", typeInt, unitCount, kindCounter, "the number of points which failed to be written into shard"},
+	{nsTypeStats, "shard", "writePointsOk", typeInt, unitCount, kindCounter, "the number of points written successfully for shard space"},
+	{nsTypeStats, "shard", "writeReq", typeInt, unitCount, kindCounter, "the number of write requests for shard space"},
+	{nsTypeStats, "shard", "writeReqErr", typeInt, unitCount, kindCounter, "the number of write requests for shard space which failed"},
+	{nsTypeStats, "shard", "writeReqOk", typeInt, unitCount, kindCounter, "the number of write requests for shard space which succeeded"},
+
+	{nsTypeStats, "subscriber", "pointsWritten", typeInt, unitCount, kindCounter, "the number of points sent to subscriptions"},
+	{nsTypeStats, "subscriber", "writeFailures", typeInt, unitCount, kindCounter, "the number of failed writes to subscriptions"},
+
+	{nsTypeStats, "tsm1_cache", "WALCompactionTimeMs", typeInt, unitMs, kindCounter, "the total time spent compacting cache into TSM files"},
+	{nsTypeStats, "tsm1_cache", "cacheAgeMs", typeInt, unitMs, kindGauge, "the time since the last snapshot of cache"},
+	{nsTypeStats, "tsm1_cache", "cachedBytes", typeInt, unitBytes, kindCounter, "the sum of bytes written into snapshots of cache"},
+	{nsTypeStats, "tsm1_cache", "diskBytes", typeInt, unitBytes, kindGauge, "the size of cache snapshots"},
+	{nsTypeStats, "tsm1_cache", "memBytes", typeInt, unitBytes, kindGauge, "the size of cache in memory"},
+	{nsTypeStats, "tsm1_cache", "snapshotCount", typeInt, unitCount, kindGauge, "the number of active snapshots of cache"},
+	{nsTypeStats, "tsm1_cache", "writeDropped", typeInt, unitCount, kindCounter, "the number of writes into cache which were dropped"},
+	{nsTypeStats, "tsm1_cache", "writeErr", typeInt, unitCount, kindCounter, "the number of writes into cache which failed"},
+	{nsTypeStats, "tsm1_cache", "writeOk", typeInt, unitCount, kindCounter, "the number of writes into cache which succeeded"},
+
+	{nsTypeStats, "tsm1_filestore", "diskBytes", typeInt, unitBytes, kindGauge, "the size of TSM files"},
+	{nsTypeStats, "tsm1_filestore", "numFiles", typeInt, unitCount, kindGauge, "the number of TSM files"},
+
+	{nsTypeStats, "tsm1_wal", "currentSegmentDiskBytes", typeInt, unitBytes, kindGauge, "the size of the current WAL segment"},
+	{nsTypeStats, "tsm1_wal", "oldSegmentsDiskBytes", typeInt, unitBytes, kindGauge, "the size of closed WAL segments"},
+	{nsTypeStats, "tsm1_wal", "writeErr", typeInt, unitCount, kindCounter, "the number of writes into WAL which failed"},
+	{nsTypeStats, "tsm1_wal", "writeOk", typeInt, unitCount, kindCounter, "the number of writes into WAL which succeeded"},
+
+	{nsTypeStats, "write", "pointReq", typeInt, unitCount, kindCounter, "the number of written points"},
+	{nsTypeStats, "write", "pointReqLocal", typeInt, unitCount, kindCounter, "the number of locally written points"},
+	{nsTypeStats, "write", "req", typeInt, unitCount, kindCounter, "the number of write requests"},
+	{nsTypeStats, "write", "subWriteDrop", typeInt, unitCount, kindCounter, "the number of writes to subscriptions which were dropped"},
+	{nsTypeStats, "write", "subWriteOk", typeInt, unitCount, kindCounter, "the number of writes to subscriptions which succeeded"},
+	{nsTypeStats, "write", "writeDrop", typeInt, unitCount, kindCounter, "the number of write requests which were dropped"},
+	{nsTypeStats, "write", "writeError", typeInt, unitCount, kindCounter, "the number of write requests which failed"},
+	{nsTypeStats, "write", "writeOk", typeInt, unitCount, kindCounter, "the number of successful write requests"},
+	{nsTypeStats, "write", "writeTimeout", typeInt, unitCount, kindCounter, "the number of write requests which timed out"},
+}, append(compactionCatalog(), scrapeCatalog()...)...)
+
+// compactionCatalog returns entries of compaction statistics of storage engine (module `tsm1_engine`)
+func compactionCatalog() []catalogEntry {
+	entries := []catalogEntry{}
+	compactions := []struct{ prefix, description string }{
+		{"cache", "snapshots of cache"},
+		{"tsmLevel1", "level 1 compactions of TSM files"},
+		{"tsmLevel2", "level 2 compactions of TSM files"},
+		{"tsmLevel3", "level 3 compactions of TSM files"},
+		{"tsmOptimize", "optimize compactions of TSM files"},
+		{"tsmFull", "full compactions of TSM files"},
+	}
+	for _, c := range compactions {
+		// statistics of snapshots are named e.g. `cacheCompactions`, the others e.g. `tsmLevel1Compactions`
+		entries = append(entries,
+			catalogEntry{nsTypeStats, "tsm1_engine", c.prefix + "Compactions", typeInt, unitCount, kindCounter, "the number of " + c.description},
+			catalogEntry{nsTypeStats, "tsm1_engine", c.prefix + "CompactionsActive", typeInt, unitCount, kindGauge, "the number of " + c.description + " in progress"},
+			catalogEntry{nsTypeStats, "tsm1_engine", c.prefix + "CompactionErr", typeInt, unitCount, kindCounter, "the number of " + c.description + " which failed"},
+			catalogEntry{nsTypeStats, "tsm1_engine", c.prefix + "CompactionDuration", typeInt, unitNs, kindCounter, "the total time spent on " + c.description},
+		)
+	}
+	return entries
+}
+
+// scrapeCatalog returns entries of metrics of collector describing the last query of each source of metrics
+func scrapeCatalog() []catalogEntry {
+	sources := []struct {
+		name  string
+		query string
+	}{
+		{sourceDebugVars, "request of /debug/vars"},
+		{sourceDiagnostics, "query SHOW DIAGNOSTICS"},
+		{sourcePrometheus, "request of /metrics"},
+		{sourceStats, "query SHOW STATS"},
+	}
+	entries := []catalogEntry{}
+	for _, s := range sources {
+		entries = append(entries,
+			catalogEntry{nsTypeCollector, s.name, "scrape_duration_seconds", typeFloat, unitSeconds, kindGauge, "the duration of the last " + s.query},
+			catalogEntry{nsTypeCollector, s.name, "response_bytes", typeInt, unitBytes, kindGauge, "the size of the response to the last " + s.query},
+			catalogEntry{nsTypeCollector, s.name, "series", typeInt, unitCount, kindGauge, "the number of series in the response to the last " + s.query},
+			catalogEntry{nsTypeCollector, s.name, "metrics", typeInt, unitCount, kindGauge, "the number of metrics built from the response to the last " + s.query},
+		)
+	}
+	return entries
+}
+
+// catalogIndex holds entries of catalog by their key (see catalogKey)
+var catalogIndex = map[string]catalogEntry{}
+
+func init() {
+	for _, e := range catalog {
+		catalogIndex[catalogKey(e.nsType, e.module, e.name)] = e
+	}
+}
+
+// catalogKey returns key of metric `name` of type `nsType` (stat, diagn or collector) and module `module`
+func catalogKey(nsType string, module string, name string) string {
+	return strings.Join([]string{nsType, module, name}, "/")
+}
+
+// lookupCatalog returns catalog entry of metric with namespace `ns`, values of dynamic elements are not relevant
+func lookupCatalog(ns plugin.Namespace) (catalogEntry, bool) {
+	elements := ns.Strings()
+	var key string
+	switch {
+	case len(elements) == 4 && elements[2] == nsTypeCollector:
+		key = catalogKey(elements[2], "", elements[3])
+	case len(elements) >= 5:
+		key = catalogKey(elements[2], elements[3], elements[len(elements)-1])
+	default:
+		return catalogEntry{}, false
+	}
+	e, ok := catalogIndex[key]
+	return e, ok
+}
+
+// describe returns description of the metric including its semantics
+func (e catalogEntry) describe() string {
+	if e.dataType == typeString || e.dataType == typeBool {
+		return e.description
+	}
+	if e.kind == kindCounter {
+		return e.description + " (counter)"
+	}
+	return e.description + " (gauge)"
+}
+
+// withMetadata returns metric type `mt` with description and unit filled from the catalog,
+// rates and deltas of counters are described by the counter they are derived from
+func withMetadata(mt plugin.Metric) plugin.Metric {
+	ns := mt.Namespace
+	suffix := ""
+	if last := ns[len(ns)-1].Value; len(ns) > 5 && (last == nsRate || last == nsDelta) {
+		if e, ok := lookupCatalog(ns[:len(ns)-1]); ok && e.kind == kindCounter {
+			suffix = last
+			ns = ns[:len(ns)-1]
+		}
+	}
+
+	e, ok := lookupCatalog(ns)
+	if !ok {
+		return mt
+	}
+	switch suffix {
+	case nsRate:
+		mt.Description = "per second rate of " + e.description + " (gauge)"
+		mt.Unit = e.unit + "/s"
+	case nsDelta:
+		mt.Description = "increase since the previous collection of " + e.description + " (gauge)"
+		mt.Unit = e.unit
+	default:
+		mt.Description = e.describe()
+		mt.Unit = e.unit
+	}
+	return mt
+}
+
+// namespace returns namespace of metric type described by the entry, with wildcards in place of dynamic elements
+func (e catalogEntry) namespace() plugin.Namespace {
+	switch e.nsType {
+	case nsTypeCollector:
+		if e.module == "" {
+			return plugin.NewNamespace(nsVendor, nsClass, nsTypeCollector, e.name)
+		}
+	case nsTypeStats:
+		tags := map[string]string{}
+		for _, de := range dynamicElements(e.module) {
+			tags[de.tag] = nsWildcard
+		}
+		return statNamespace(e.module, tags, e.name)
+	}
+	return plugin.NewNamespace(nsVendor, nsClass, e.nsType, e.module, e.name)
+}
+
+// zeroValue returns zero value of data type of the metric
+func (e catalogEntry) zeroValue() interface{} {
+	switch e.dataType {
+	case typeInt:
+		return int64(0)
+	case typeFloat:
+		return float64(0)
+	case typeBool:
+		return false
+	}
+	return ""
+}
+
+// staticMetricTypes returns metric types listed in the catalog, their data hold zero value of the data type
+func staticMetricTypes() []plugin.Metric {
+	mts := make([]plugin.Metric, 0, len(catalog))
+	for _, e := range catalog {
+		mts = append(mts, plugin.Metric{Namespace: e.namespace(), Data: e.zeroValue()})
+	}
+	return mts
+}
@@ -0,0 +1,184 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCatalog(t *testing.T) {
+	Convey("Looking up catalog of metrics", t, func() {
+		Convey("finds statistics regardless of dynamic elements", func() {
+			e, ok := lookupCatalog(mockShardNamespace("writePointsOk"))
+			So(ok, ShouldBeTrue)
+			So(e.kind, ShouldEqual, kindCounter)
+			So(e.unit, ShouldEqual, unitCount)
+		})
+		Convey("finds metrics of collector", func() {
+			e, ok := lookupCatalog(plugin.NewNamespace("intel", "influxdb", "collector", "errors"))
+			So(ok, ShouldBeTrue)
+			So(e.dataType, ShouldEqual, typeInt)
+		})
+		Convey("does not find unknown metrics", func() {
+			_, ok := lookupCatalog(plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "unknown"))
+			So(ok, ShouldBeFalse)
+		})
+		Convey("has no duplicated entries", func() {
+			So(len(catalogIndex), ShouldEqual, len(catalog))
+		})
+	})
+
+	Convey("Getting metric types", t, func() {
+		influxdbPlugin := &influxdbCollector{
+			getResponse: getMockHTTPResponse,
+			endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
+		}
+		mts, err := influxdbPlugin.GetMetricTypes(getMockConfig())
+		So(err, ShouldBeNil)
+		types := map[string]plugin.Metric{}
+		for _, mt := range mts {
+			types[mt.Namespace.String()] = mt
+		}
+
+		Convey("fills in description and unit of known metrics", func() {
+			mt := types["/intel/influxdb/stat/runtime/HeapAlloc"]
+			So(mt.Description, ShouldEqual, "bytes of the heap space allocated and not yet freed (gauge)")
+			So(mt.Unit, ShouldEqual, unitBytes)
+			mt = types["/intel/influxdb/stat/httpd/queryReqDurationNs"]
+			So(mt.Description, ShouldEqual, "the total time spent serving query requests (counter)")
+			So(mt.Unit, ShouldEqual, unitNs)
+			mt = types["/intel/influxdb/diagn/build/Version"]
+			So(mt.Description, ShouldEqual, "the InfluxDB version")
+		})
+		Convey("describes rates and deltas by their counters", func() {
+			mt := types["/intel/influxdb/stat/httpd/writeReqBytes/rate"]
+			So(mt.Description, ShouldEqual, "per second rate of the sum of all bytes in write requests (gauge)")
+			So(mt.Unit, ShouldEqual, "bytes/s")
+			mt = types["/intel/influxdb/stat/shard/*/*/*/*/writeReq/delta"]
+			So(mt.Description, ShouldStartWith, "increase since the previous collection of")
+			So(mt.Unit, ShouldEqual, unitCount)
+		})
+		Convey("describes every metric of InfluxDB", func() {
+			for _, mt := range types {
+				So(mt.Description, ShouldNotBeEmpty)
+				_, known := lookupCatalog(mt.Namespace)
+				So(known || mt.Namespace[len(mt.Namespace)-1].Value == nsRate || mt.Namespace[len(mt.Namespace)-1].Value == nsDelta, ShouldBeTrue)
+			}
+		})
+	})
+}
+
+func TestCatalogMode(t *testing.T) {
+	Convey("Getting metric types when InfluxDB is unreachable", t, func() {
+		influxdbPlugin := &influxdbCollector{
+			getResponse: getUnreachableMockHTTPResponse,
+			endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
+		}
+		namespaces := func(mts []plugin.Metric) map[string]bool {
+			res := map[string]bool{}
+			for _, mt := range mts {
+				res[mt.Namespace.String()] = true
+			}
+			return res
+		}
+
+		Convey("fails in live mode", func() {
+			influxdbPlugin.catalogMode = catalogLive
+			mts, err := influxdbPlugin.GetMetricTypes(getMockConfig())
+			So(err, ShouldNotBeNil)
+			So(mts, ShouldBeEmpty)
+		})
+		Convey("returns built-in catalog in static mode", func() {
+			influxdbPlugin.catalogMode = catalogStatic
+			mts, err := influxdbPlugin.GetMetricTypes(getMockConfig())
+			So(err, ShouldBeNil)
+			types := namespaces(mts)
+			So(types["/intel/influxdb/stat/shard/*/*/*/*/writePointsOk"], ShouldBeTrue)
+			So(types["/intel/influxdb/stat/shard/*/*/*/*/writePointsOk/rate"], ShouldBeTrue)
+			So(types["/intel/influxdb/stat/database/*/numSeries"], ShouldBeTrue)
+			So(types["/intel/influxdb/stat/database/*/numSeries/rate"], ShouldBeFalse)
+			So(types["/intel/influxdb/diagn/system/PID"], ShouldBeTrue)
+			So(types["/intel/influxdb/collector/errors"], ShouldBeTrue)
+			for _, mt := range mts {
+				So(mt.Description, ShouldNotBeEmpty)
+			}
+			for _, mt := range mts {
+				if mt.Namespace.String() == "/intel/influxdb/stat/shard/*/*/*/*/writePointsOk" {
+					isDynamic, _ := mt.Namespace.IsDynamic()
+					So(isDynamic, ShouldBeTrue)
+				}
+			}
+		})
+		Convey("falls back to built-in catalog in merged mode", func() {
+			influxdbPlugin.catalogMode = catalogMerged
+			mts, err := influxdbPlugin.GetMetricTypes(getMockConfig())
+			So(err, ShouldBeNil)
+			So(len(mts), ShouldEqual, len(staticMetricTypesWithDerived()))
+		})
+	})
+
+	Convey("Getting metric types in merged mode", t, func() {
+		influxdbPlugin := &influxdbCollector{
+			getResponse: getMockHTTPResponse,
+			endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
+		}
+		live, err := influxdbPlugin.GetMetricTypes(getMockConfig())
+		So(err, ShouldBeNil)
+
+		influxdbPlugin.catalogMode = catalogMerged
+		merged, err := influxdbPlugin.GetMetricTypes(getMockConfig())
+		So(err, ShouldBeNil)
+		types := map[string]bool{}
+		for _, mt := range merged {
+			So(types[mt.Namespace.String()], ShouldBeFalse)
+			types[mt.Namespace.String()] = true
+		}
+		for _, mt := range live {
+			So(types[mt.Namespace.String()], ShouldBeTrue)
+		}
+		So(types["/intel/influxdb/stat/engine/blksWrite"], ShouldBeTrue)
+		So(len(merged), ShouldBeGreaterThan, len(live))
+	})
+
+	Convey("Initializing plugin with catalog mode", t, func() {
+		influxdbPlugin := &influxdbCollector{getResponse: getMockHTTPResponse}
+		cfg := getMockConfig()
+		cfg["catalog_mode"] = "offline"
+		err := influxdbPlugin.init(cfg)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "Invalid catalog_mode")
+	})
+}
+
+func getUnreachableMockHTTPResponse(ctx context.Context, url string) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+// staticMetricTypesWithDerived returns metric types of the catalog with rates and deltas of counters
+func staticMetricTypesWithDerived() []plugin.Metric {
+	influxdbPlugin := &influxdbCollector{
+		endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
+		catalogMode: catalogStatic,
+	}
+	mts, _ := influxdbPlugin.GetMetricTypes(plugin.Config{})
+	return mts
+}
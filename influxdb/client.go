@@ -0,0 +1,245 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	schemeHTTP  = "http"
+	schemeHTTPS = "https"
+
+	authQuery  = "query"
+	authBasic  = "basic"
+	authBearer = "bearer"
+	authToken  = "token"
+)
+
+// authOptions holds credentials and the method used to pass them to InfluxDB
+type authOptions struct {
+	method   string
+	user     string
+	password string
+	token    string
+}
+
+// validate checks if authentication method is known and has required credentials
+func (a authOptions) validate() error {
+	switch a.method {
+	case authQuery, authBasic:
+		return nil
+	case authBearer, authToken:
+		if a.token == "" {
+			return fmt.Errorf("Authentication method `%s` requires a token", a.method)
+		}
+		return nil
+	}
+	return fmt.Errorf("Invalid authentication method `%s`, expected one of `%s`, `%s`, `%s` or `%s`",
+		a.method, authQuery, authBasic, authBearer, authToken)
+}
+
+// setQuery adds credentials to URL query parameters when query authentication is used
+func (a authOptions) setQuery(q url.Values) {
+	if a.method == authQuery {
+		q.Set("u", a.user)
+		q.Set("p", a.password)
+	}
+}
+
+// setHeader adds credentials to request headers when header based authentication is used
+func (a authOptions) setHeader(req *http.Request) {
+	switch a.method {
+	case authBasic:
+		if a.user != "" || a.password != "" {
+			req.SetBasicAuth(a.user, a.password)
+		}
+	case authBearer:
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	case authToken:
+		req.Header.Set("Authorization", "Token "+a.token)
+	}
+}
+
+// tlsOptions holds settings used to establish HTTPS connection to InfluxDB
+type tlsOptions struct {
+	caFile             string
+	certFile           string
+	keyFile            string
+	serverName         string
+	insecureSkipVerify bool
+}
+
+// newTLSConfig returns TLS configuration based on given options
+func newTLSConfig(opts tlsOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         opts.serverName,
+		InsecureSkipVerify: opts.insecureSkipVerify,
+	}
+
+	if opts.caFile != "" {
+		caCert, err := ioutil.ReadFile(opts.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read CA file, err=%s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("Cannot parse any PEM certificate from CA file %s", opts.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.certFile != "" || opts.keyFile != "" {
+		if opts.certFile == "" || opts.keyFile == "" {
+			return nil, errors.New("Both cert_file and key_file must be set to use client certificate")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.certFile, opts.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot load client certificate, err=%s", err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// newHTTPClient returns HTTP client for the given scheme, configured with TLS settings when scheme is https;
+// `timeout` limits the time of a single request, zero means no limit; `maxConcurrency` idle connections
+// are kept per instance, so connections of concurrent queries are reused by the next collection
+func newHTTPClient(scheme string, opts tlsOptions, timeout time.Duration, maxConcurrency int) (*http.Client, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConnsPerHost: maxConcurrency,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	switch scheme {
+	case schemeHTTP:
+	case schemeHTTPS:
+		tlsConfig, err := newTLSConfig(opts)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	default:
+		return nil, fmt.Errorf("Invalid scheme `%s`, expected `%s` or `%s`", scheme, schemeHTTP, schemeHTTPS)
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
+
+// getHttpResponse performs HTTP GET request and returns the body of the response,
+// the request is retried on transient failures up to `retries` times
+func (ic *influxdbCollector) getHttpResponse(ctx context.Context, url string) ([]byte, error) {
+	client := ic.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	for attempt := 0; ; attempt++ {
+		body, _, retry, err := ic.doRequest(ctx, client, url)
+		if !retry || attempt >= ic.retries {
+			return body, err
+		}
+
+		backoff := ic.retryBackoff * time.Duration(1<<uint(attempt))
+		log.WithFields(log.Fields{
+			"block":    "client",
+			"function": "getHttpResponse",
+			"attempt":  attempt + 1,
+			"backoff":  backoff.String(),
+			"err":      err,
+		}).Warn("Request to InfluxDB failed, retrying")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// getPingResponse performs HTTP GET request without retries and returns headers of the response,
+// which are also returned along with the error when InfluxDB responds with non-2xx status code
+func (ic *influxdbCollector) getPingResponse(ctx context.Context, url string) (http.Header, error) {
+	client := ic.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	_, header, _, err := ic.doRequest(ctx, client, url)
+	return header, err
+}
+
+// doRequest performs single HTTP GET request, `retry` reports if the request failed with a transient error
+func (ic *influxdbCollector) doRequest(ctx context.Context, client *http.Client, url string) (body []byte, header http.Header, retry bool, err error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	req = req.WithContext(ctx)
+	ic.auth.setHeader(req)
+
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, nil, ctx.Err() == nil && isTransient(err), err
+	}
+	defer response.Body.Close()
+
+	body, err = ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, response.Header, ctx.Err() == nil && isTransient(err), err
+	}
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		err := newResponseError(response.StatusCode, body)
+		return nil, response.Header, isServerError(err), err
+	}
+	return body, response.Header, false, nil
+}
+
+// isTransient checks if error of the request is worth retrying (timeouts, refused or reset connections)
+func isTransient(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	if opErr, ok := err.(*net.OpError); ok {
+		if dnsErr, ok := opErr.Err.(*net.DNSError); ok {
+			return dnsErr.Temporary()
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,313 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// writeMockCertificate generates self-signed certificate valid for both server and client authentication
+// and writes it with its private key into `dir`
+func writeMockCertificate(dir string) (certFile string, keyFile string, cert tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	So(err, ShouldBeNil)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "influxdb"},
+		DNSNames:              []string{"influxdb"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	So(err, ShouldBeNil)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	So(err, ShouldBeNil)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	So(ioutil.WriteFile(certFile, certPEM, 0600), ShouldBeNil)
+	So(ioutil.WriteFile(keyFile, keyPEM, 0600), ShouldBeNil)
+
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	So(err, ShouldBeNil)
+	return certFile, keyFile, cert
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	Convey("Creating HTTP client", t, func() {
+		dir, err := ioutil.TempDir("", "snap-plugin-collector-influxdb")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		certFile, keyFile, cert := writeMockCertificate(dir)
+
+		Convey("fails for unknown scheme", func() {
+			client, err := newHTTPClient("ftp", tlsOptions{}, time.Second, defaultMaxConcurrency)
+			So(err, ShouldNotBeNil)
+			So(client, ShouldBeNil)
+		})
+		Convey("fails when CA file does not exist", func() {
+			client, err := newHTTPClient(schemeHTTPS, tlsOptions{caFile: filepath.Join(dir, "missing.pem")}, time.Second, defaultMaxConcurrency)
+			So(err, ShouldNotBeNil)
+			So(client, ShouldBeNil)
+		})
+		Convey("fails when CA file has no certificate", func() {
+			client, err := newHTTPClient(schemeHTTPS, tlsOptions{caFile: keyFile}, time.Second, defaultMaxConcurrency)
+			So(err, ShouldNotBeNil)
+			So(client, ShouldBeNil)
+		})
+		Convey("fails when only one of cert_file and key_file is set", func() {
+			client, err := newHTTPClient(schemeHTTPS, tlsOptions{certFile: certFile}, time.Second, defaultMaxConcurrency)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "key_file")
+			So(client, ShouldBeNil)
+		})
+		Convey("keeps idle connections of all concurrent queries", func() {
+			client, err := newHTTPClient(schemeHTTP, tlsOptions{}, time.Second, 16)
+			So(err, ShouldBeNil)
+			So(client.Transport.(*http.Transport).MaxIdleConnsPerHost, ShouldEqual, 16)
+		})
+		Convey("ignores TLS options for plain http", func() {
+			client, err := newHTTPClient(schemeHTTP, tlsOptions{caFile: filepath.Join(dir, "missing.pem")}, time.Second, defaultMaxConcurrency)
+			So(err, ShouldBeNil)
+			So(client, ShouldNotBeNil)
+		})
+
+		Convey("against HTTPS server requiring client certificate", func() {
+			leaf, err := x509.ParseCertificate(cert.Certificate[0])
+			So(err, ShouldBeNil)
+			pool := x509.NewCertPool()
+			pool.AddCert(leaf)
+
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(mockStatResults))
+			}))
+			ts.TLS = &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				ClientCAs:    pool,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			}
+			ts.StartTLS()
+			defer ts.Close()
+
+			Convey("succeeds with CA and client certificate", func() {
+				ic := &influxdbCollector{}
+				ic.client, err = newHTTPClient(schemeHTTPS, tlsOptions{caFile: certFile, certFile: certFile, keyFile: keyFile}, time.Second, defaultMaxConcurrency)
+				So(err, ShouldBeNil)
+
+				response, err := ic.getHttpResponse(context.Background(), ts.URL)
+				So(err, ShouldBeNil)
+				So(string(response), ShouldEqual, mockStatResults)
+			})
+			Convey("succeeds when server name is overridden", func() {
+				ic := &influxdbCollector{}
+				ic.client, err = newHTTPClient(schemeHTTPS, tlsOptions{caFile: certFile, certFile: certFile, keyFile: keyFile, serverName: "influxdb"}, time.Second, defaultMaxConcurrency)
+				So(err, ShouldBeNil)
+
+				_, err = ic.getHttpResponse(context.Background(), ts.URL)
+				So(err, ShouldBeNil)
+			})
+			Convey("fails without client certificate", func() {
+				ic := &influxdbCollector{}
+				ic.client, err = newHTTPClient(schemeHTTPS, tlsOptions{caFile: certFile}, time.Second, defaultMaxConcurrency)
+				So(err, ShouldBeNil)
+
+				_, err = ic.getHttpResponse(context.Background(), ts.URL)
+				So(err, ShouldNotBeNil)
+			})
+			Convey("fails when server certificate cannot be verified", func() {
+				ic := &influxdbCollector{}
+				ic.client, err = newHTTPClient(schemeHTTPS, tlsOptions{certFile: certFile, keyFile: keyFile}, time.Second, defaultMaxConcurrency)
+				So(err, ShouldBeNil)
+
+				_, err = ic.getHttpResponse(context.Background(), ts.URL)
+				So(err, ShouldNotBeNil)
+			})
+			Convey("succeeds with skipped verification of server certificate", func() {
+				ic := &influxdbCollector{}
+				ic.client, err = newHTTPClient(schemeHTTPS, tlsOptions{certFile: certFile, keyFile: keyFile, insecureSkipVerify: true}, time.Second, defaultMaxConcurrency)
+				So(err, ShouldBeNil)
+
+				_, err = ic.getHttpResponse(context.Background(), ts.URL)
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestAuthentication(t *testing.T) {
+	Convey("Validating authentication options", t, func() {
+		So(authOptions{method: authQuery}.validate(), ShouldBeNil)
+		So(authOptions{method: authBasic}.validate(), ShouldBeNil)
+		So(authOptions{method: authToken, token: "secret"}.validate(), ShouldBeNil)
+		So(authOptions{method: authBearer}.validate(), ShouldNotBeNil)
+		So(authOptions{method: "digest"}.validate(), ShouldNotBeNil)
+	})
+
+	Convey("Creating URL", t, func() {
+		Convey("includes credentials for query authentication", func() {
+			u, err := createURL(schemeHTTP, "hostname:1234", authOptions{method: authQuery, user: "test", password: "p&sswd"}, "show stats")
+			So(err, ShouldBeNil)
+			So(u.Query().Get("u"), ShouldEqual, "test")
+			So(u.Query().Get("p"), ShouldEqual, "p&sswd")
+			So(u.Query().Get("q"), ShouldEqual, "show stats")
+		})
+		Convey("does not include credentials for header authentication", func() {
+			u, err := createURL(schemeHTTPS, "hostname:1234", authOptions{method: authBasic, user: "test", password: "passwd"}, "show stats")
+			So(err, ShouldBeNil)
+			So(u.Scheme, ShouldEqual, schemeHTTPS)
+			So(u.String(), ShouldNotContainSubstring, "passwd")
+			So(u.Query().Get("q"), ShouldEqual, "show stats")
+		})
+	})
+
+	Convey("Sending request", t, func() {
+		var authorization string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+		}))
+		defer ts.Close()
+
+		Convey("uses basic authentication header", func() {
+			ic := &influxdbCollector{auth: authOptions{method: authBasic, user: "test", password: "passwd"}}
+			_, err := ic.getHttpResponse(context.Background(), ts.URL)
+			So(err, ShouldBeNil)
+			So(authorization, ShouldStartWith, "Basic ")
+		})
+		Convey("uses bearer token header", func() {
+			ic := &influxdbCollector{auth: authOptions{method: authBearer, token: "secret"}}
+			_, err := ic.getHttpResponse(context.Background(), ts.URL)
+			So(err, ShouldBeNil)
+			So(authorization, ShouldEqual, "Bearer secret")
+		})
+		Convey("uses token header", func() {
+			ic := &influxdbCollector{auth: authOptions{method: authToken, token: "secret"}}
+			_, err := ic.getHttpResponse(context.Background(), ts.URL)
+			So(err, ShouldBeNil)
+			So(authorization, ShouldEqual, "Token secret")
+		})
+		Convey("does not use any header for query authentication", func() {
+			ic := &influxdbCollector{auth: authOptions{method: authQuery, user: "test", password: "passwd"}}
+			_, err := ic.getHttpResponse(context.Background(), ts.URL)
+			So(err, ShouldBeNil)
+			So(authorization, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestRetries(t *testing.T) {
+	Convey("Sending request to InfluxDB", t, func() {
+		var mutex sync.Mutex
+		requests := 0
+		failures := 0
+		status := http.StatusServiceUnavailable
+		delay := time.Duration(0)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			requests++
+			fail := requests <= failures
+			mutex.Unlock()
+
+			time.Sleep(delay)
+			if fail {
+				w.WriteHeader(status)
+				return
+			}
+			w.Write([]byte(mockStatResults))
+		}))
+		defer ts.Close()
+		getRequests := func() int {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return requests
+		}
+
+		client, err := newHTTPClient(schemeHTTP, tlsOptions{}, 100*time.Millisecond, defaultMaxConcurrency)
+		So(err, ShouldBeNil)
+		ic := &influxdbCollector{client: client, retries: 2, retryBackoff: time.Millisecond}
+
+		Convey("succeeds after transient server errors", func() {
+			failures = 2
+			response, err := ic.getHttpResponse(context.Background(), ts.URL)
+			So(err, ShouldBeNil)
+			So(string(response), ShouldEqual, mockStatResults)
+			So(getRequests(), ShouldEqual, 3)
+		})
+		Convey("fails when server errors persist", func() {
+			failures = 3
+			_, err := ic.getHttpResponse(context.Background(), ts.URL)
+			So(err, ShouldNotBeNil)
+			So(getRequests(), ShouldEqual, 3)
+		})
+		Convey("does not retry when retries are disabled", func() {
+			failures = 1
+			ic.retries = 0
+			_, err := ic.getHttpResponse(context.Background(), ts.URL)
+			So(err, ShouldNotBeNil)
+			So(getRequests(), ShouldEqual, 1)
+		})
+		Convey("does not retry client errors", func() {
+			failures = 1
+			status = http.StatusBadRequest
+			_, err := ic.getHttpResponse(context.Background(), ts.URL)
+			So(err, ShouldNotBeNil)
+			So(getRequests(), ShouldEqual, 1)
+		})
+		Convey("retries requests which time out", func() {
+			delay = 200 * time.Millisecond
+			_, err := ic.getHttpResponse(context.Background(), ts.URL)
+			So(err, ShouldNotBeNil)
+			So(isTransient(err), ShouldBeTrue)
+			So(getRequests(), ShouldEqual, 3)
+		})
+		Convey("does not retry cancelled requests", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := ic.getHttpResponse(ctx, ts.URL)
+			So(err, ShouldNotBeNil)
+			So(getRequests(), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,167 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	// nsRate is the last namespace element of per second rate of a counter
+	nsRate = "rate"
+	// nsDelta is the last namespace element of increase of a counter since the previous collection
+	nsDelta = "delta"
+	// sampleExpiry is the time after which previous samples of series which are not collected anymore are dropped
+	sampleExpiry = time.Hour
+)
+
+// isCounter checks if statistic `column` of module `module` is monotonically increasing counter,
+// statistics missing in the catalog are counters unless they count operations in progress
+func isCounter(module string, column string) bool {
+	if e, ok := catalogIndex[catalogKey(nsTypeStats, module, column)]; ok {
+		return e.kind == kindCounter
+	}
+	return !strings.HasSuffix(column, "Active")
+}
+
+// derivedNamespace returns copy of counter namespace `ns` extended by element `suffix` (rate or delta)
+func derivedNamespace(ns plugin.Namespace, suffix string) plugin.Namespace {
+	res := make(plugin.Namespace, len(ns), len(ns)+1)
+	copy(res, ns)
+	return res.AddStaticElement(suffix)
+}
+
+// isDerived checks if requested namespace `ns` may refer to rate or delta of a counter
+func isDerived(ns plugin.Namespace) bool {
+	if len(ns) == 0 {
+		return false
+	}
+	last := ns[len(ns)-1].Value
+	return last == nsRate || last == nsDelta || last == nsWildcard
+}
+
+// sample is the value of a counter observed at the given time
+type sample struct {
+	value interface{}
+	ts    time.Time
+}
+
+// counterStore holds previous samples of counters of a single InfluxDB instance, keyed by series (see seriesKey)
+type counterStore struct {
+	sync.Mutex
+	samples map[string]sample
+}
+
+// derive returns rate and delta of counters among statistics `mts` collected at `ts`,
+// computed against samples of the previous collection; the first sample of a series yields nothing,
+// as well as samples collected after restart of InfluxDB (`reset`) or reset of the counter
+func (s *counterStore) derive(mts []plugin.Metric, ts time.Time, reset bool) []plugin.Metric {
+	s.Lock()
+	defer s.Unlock()
+	if s.samples == nil {
+		s.samples = map[string]sample{}
+	}
+
+	res := []plugin.Metric{}
+	for _, mt := range mts {
+		ns := mt.Namespace.Strings()
+		if len(ns) < 5 || ns[2] != nsTypeStats || !isCounter(ns[3], ns[len(ns)-1]) {
+			continue
+		}
+		if _, ok := toFloat(mt.Data); !ok {
+			continue
+		}
+
+		key := seriesKey(mt)
+		prev, ok := s.samples[key]
+		s.samples[key] = sample{value: mt.Data, ts: ts}
+		if !ok || reset {
+			continue
+		}
+		elapsed := ts.Sub(prev.ts).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+
+		delta, rate, ok := counterDelta(prev.value, mt.Data, elapsed)
+		if !ok {
+			continue
+		}
+		res = append(res,
+			plugin.Metric{Namespace: derivedNamespace(mt.Namespace, nsDelta), Data: delta, Tags: mt.Tags},
+			plugin.Metric{Namespace: derivedNamespace(mt.Namespace, nsRate), Data: rate, Tags: mt.Tags},
+		)
+	}
+
+	for key, smpl := range s.samples {
+		if ts.Sub(smpl.ts) > sampleExpiry {
+			delete(s.samples, key)
+		}
+	}
+	return res
+}
+
+// seriesKey returns key identifying series of metric `mt` by its namespace and sorted tags,
+// series of the same module may differ only by tags, e.g. module httpd has one series per bind address
+func seriesKey(mt plugin.Metric) string {
+	names := make([]string, 0, len(mt.Tags))
+	for name := range mt.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	key := mt.Namespace.String()
+	for _, name := range names {
+		key += "," + name + "=" + mt.Tags[name]
+	}
+	return key
+}
+
+// counterDelta returns increase of counter from `prev` to `cur` and its per second rate over `elapsed` seconds,
+// counter which decreased has been reset and its increase is unknown
+func counterDelta(prev interface{}, cur interface{}, elapsed float64) (interface{}, float64, bool) {
+	p, pok := prev.(int64)
+	c, cok := cur.(int64)
+	if pok && cok {
+		if c < p {
+			return nil, 0, false
+		}
+		return c - p, float64(c-p) / elapsed, true
+	}
+
+	pf, _ := toFloat(prev)
+	cf, _ := toFloat(cur)
+	if cf < pf {
+		return nil, 0, false
+	}
+	return cf - pf, (cf - pf) / elapsed, true
+}
+
+// toFloat converts numeric value of metric to float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,164 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCounters(t *testing.T) {
+	Convey("Recognizing counters", t, func() {
+		So(isCounter("httpd", "req"), ShouldBeTrue)
+		So(isCounter("shard", "writePointsOk"), ShouldBeTrue)
+		So(isCounter("runtime", "TotalAlloc"), ShouldBeTrue)
+		So(isCounter("runtime", "HeapAlloc"), ShouldBeFalse)
+		So(isCounter("httpd", "reqActive"), ShouldBeFalse)
+		So(isCounter("database", "numSeries"), ShouldBeFalse)
+	})
+
+	Convey("Deriving counters", t, func() {
+		store := &counterStore{}
+		ts := time.Now()
+		tags := map[string]string{tagInstance: "hostname:1234"}
+		statistics := func(req int64, heap int64) []plugin.Metric {
+			return []plugin.Metric{
+				{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "req"), Data: req, Tags: tags},
+				{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "runtime", "HeapAlloc"), Data: heap, Tags: tags},
+				{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "bind"), Data: ":8086", Tags: tags},
+			}
+		}
+
+		Convey("yields nothing for the first sample", func() {
+			So(store.derive(statistics(100, 1024), ts, false), ShouldBeEmpty)
+		})
+		Convey("yields delta and per second rate of counters", func() {
+			store.derive(statistics(100, 1024), ts, false)
+			mts := store.derive(statistics(150, 512), ts.Add(10*time.Second), false)
+			So(len(mts), ShouldEqual, 2)
+			So(mts[0].Namespace.String(), ShouldEqual, "/intel/influxdb/stat/httpd/req/delta")
+			So(mts[0].Data, ShouldEqual, int64(50))
+			So(mts[0].Tags, ShouldResemble, tags)
+			So(mts[1].Namespace.String(), ShouldEqual, "/intel/influxdb/stat/httpd/req/rate")
+			So(mts[1].Data, ShouldEqual, 5.0)
+		})
+		Convey("skips the first sample after reset of counter", func() {
+			store.derive(statistics(100, 1024), ts, false)
+			So(store.derive(statistics(20, 1024), ts.Add(10*time.Second), false), ShouldBeEmpty)
+			mts := store.derive(statistics(40, 1024), ts.Add(20*time.Second), false)
+			So(len(mts), ShouldEqual, 2)
+			So(mts[0].Data, ShouldEqual, int64(20))
+			So(mts[1].Data, ShouldEqual, 2.0)
+		})
+		Convey("skips the first sample after restart of InfluxDB", func() {
+			store.derive(statistics(100, 1024), ts, false)
+			So(store.derive(statistics(150, 1024), ts.Add(10*time.Second), true), ShouldBeEmpty)
+			mts := store.derive(statistics(200, 1024), ts.Add(20*time.Second), false)
+			So(len(mts), ShouldEqual, 2)
+			So(mts[0].Data, ShouldEqual, int64(50))
+		})
+		Convey("handles counters of floating point values", func() {
+			ns := plugin.NewNamespace("intel", "influxdb", "stat", "cq", "queryOk")
+			store.derive([]plugin.Metric{{Namespace: ns, Data: 1.5}}, ts, false)
+			mts := store.derive([]plugin.Metric{{Namespace: ns, Data: 4.0}}, ts.Add(time.Second), false)
+			So(len(mts), ShouldEqual, 2)
+			So(mts[0].Data, ShouldEqual, 2.5)
+			So(mts[1].Data, ShouldEqual, 2.5)
+		})
+		Convey("keeps samples of series differing only by tags apart", func() {
+			ns := plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "req")
+			series := func(req8086 int64, req8087 int64) []plugin.Metric {
+				return []plugin.Metric{
+					{Namespace: ns, Data: req8086, Tags: map[string]string{tagInstance: "hostname:1234", "bind": ":8086"}},
+					{Namespace: ns, Data: req8087, Tags: map[string]string{tagInstance: "hostname:1234", "bind": ":8087"}},
+				}
+			}
+			store.derive(series(1000, 5), ts, false)
+			mts := store.derive(series(1010, 6), ts.Add(10*time.Second), false)
+			So(len(mts), ShouldEqual, 4)
+			So(mts[0].Namespace.String(), ShouldEqual, "/intel/influxdb/stat/httpd/req/delta")
+			So(mts[0].Tags["bind"], ShouldEqual, ":8086")
+			So(mts[0].Data, ShouldEqual, int64(10))
+			So(mts[2].Namespace.String(), ShouldEqual, "/intel/influxdb/stat/httpd/req/delta")
+			So(mts[2].Tags["bind"], ShouldEqual, ":8087")
+			So(mts[2].Data, ShouldEqual, int64(1))
+		})
+		Convey("drops samples of series which are not collected anymore", func() {
+			store.derive(statistics(100, 1024), ts, false)
+			store.derive([]plugin.Metric{}, ts.Add(2*sampleExpiry), false)
+			So(store.samples, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Collecting rates of counters", t, func() {
+		var mutex sync.Mutex
+		req := 1000
+		getCounterMockHTTPResponse := func(ctx context.Context, url string) ([]byte, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return []byte(fmt.Sprintf(`{"results":[{"series":[{"name":"httpd","tags":{"bind":":8086"},"columns":["req"],"values":[[%d]]}]}]}`, req)), nil
+		}
+		influxdbPlugin := &influxdbCollector{
+			getResponse: getCounterMockHTTPResponse,
+			endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
+		}
+		mts := []plugin.Metric{
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "req", "delta")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "req", "rate")},
+		}
+
+		results, err := influxdbPlugin.CollectMetrics(mts)
+		So(err, ShouldBeNil)
+		So(results, ShouldBeEmpty)
+
+		mutex.Lock()
+		req = 1100
+		mutex.Unlock()
+		results, err = influxdbPlugin.CollectMetrics(mts)
+		So(err, ShouldBeNil)
+		So(len(results), ShouldEqual, 2)
+		So(results[0].Namespace.String(), ShouldEqual, "/intel/influxdb/stat/httpd/req/delta")
+		So(results[0].Data, ShouldEqual, int64(100))
+		So(results[0].Tags[tagInstance], ShouldEqual, "hostname:1234")
+		So(results[1].Namespace.String(), ShouldEqual, "/intel/influxdb/stat/httpd/req/rate")
+		So(results[1].Data, ShouldBeGreaterThan, 0)
+	})
+
+	Convey("Getting metric types exposes rates and deltas of counters", t, func() {
+		influxdbPlugin := &influxdbCollector{
+			getResponse: getMockHTTPResponse,
+			endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
+		}
+		mts, err := influxdbPlugin.GetMetricTypes(getMockConfig())
+		So(err, ShouldBeNil)
+		types := map[string]bool{}
+		for _, mt := range mts {
+			types[mt.Namespace.String()] = true
+		}
+		So(types["/intel/influxdb/stat/httpd/req/rate"], ShouldBeTrue)
+		So(types["/intel/influxdb/stat/httpd/req/delta"], ShouldBeTrue)
+		So(types["/intel/influxdb/stat/shard/*/*/*/*/writePointsOk/rate"], ShouldBeTrue)
+		So(types["/intel/influxdb/stat/runtime/HeapAlloc/rate"], ShouldBeFalse)
+		So(types["/intel/influxdb/diagn/system/PID/rate"], ShouldBeFalse)
+	})
+}
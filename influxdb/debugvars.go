@@ -0,0 +1,206 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// moduleMemstats is the statistics module of Go memory allocator statistics of InfluxDB process (runtime.MemStats)
+	moduleMemstats = "memstats"
+)
+
+// debugVar is a single series of statistics reported by /debug/vars, e.g. of one shard
+type debugVar struct {
+	Name   string                 `json:"name"`
+	Tags   map[string]string      `json:"tags"`
+	Values map[string]interface{} `json:"values"`
+}
+
+// debugVarsURL returns URL of /debug/vars endpoint of InfluxDB instance available under `address`
+func debugVarsURL(scheme string, address string) (*url.URL, error) {
+	return url.Parse(fmt.Sprintf("%s://%s/debug/vars", scheme, address))
+}
+
+// queryDebugVars reads statistics of given modules, or all of them when `modules` is empty, from /debug/vars
+// of InfluxDB instance `ep`; they are the same as statistics of "SHOW STATS" plus statistics of module memstats
+func (ic *influxdbCollector) queryDebugVars(ctx context.Context, ep *endpoint, modules []string, normalize bool) ([]plugin.Metric, error) {
+	mts := []plugin.Metric{}
+	start := time.Now()
+	sc := scrape{}
+	defer func() {
+		sc.duration = time.Since(start)
+		sc.metrics = len(mts)
+		ep.scrapes.record(sourceDebugVars, sc)
+	}()
+	response, err := ic.getResponse(ctx, ep.urlDebugVars.String())
+	sc.bytes = len(response)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "queryDebugVars",
+			"instance": ep.instance,
+			"err":      err,
+		}).Error("Cannot get response from InfluxDB")
+		return nil, err
+	}
+	vars := map[string]json.RawMessage{}
+	if err := decodeResponse(response, &vars); err != nil {
+		return nil, err
+	}
+
+	// keys are sorted, so metrics are returned in stable order
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	series := []statsSeries{}
+	for _, key := range keys {
+		if key == moduleMemstats {
+			if len(modules) == 0 || containsString(modules, moduleMemstats) {
+				sc.series++
+				mts = append(mts, ic.memstatsMetrics(ep, vars[key])...)
+			}
+			continue
+		}
+		var v debugVar
+		// other variables (e.g. cmdline) are not statistics
+		if err := decodeResponse(vars[key], &v); err != nil || v.Name == "" || v.Values == nil {
+			continue
+		}
+		if len(modules) > 0 && !containsString(modules, v.Name) {
+			continue
+		}
+		series = append(series, v.series())
+	}
+	sc.series += len(series)
+	mts = append(mts, ic.seriesMetrics(ep, series, normalize)...)
+	return mts, nil
+}
+
+// series returns statistics of the variable in the form returned by "SHOW STATS"
+func (v debugVar) series() statsSeries {
+	s := statsSeries{Name: v.Name, Tags: v.Tags}
+	for column := range v.Values {
+		s.Columns = append(s.Columns, column)
+	}
+	sort.Strings(s.Columns)
+	values := make([]interface{}, len(s.Columns))
+	for i, column := range s.Columns {
+		values[i] = v.Values[column]
+	}
+	s.Values = [][]interface{}{values}
+	return s
+}
+
+// memstatsMetrics returns metrics of module memstats decoded from `raw`: numeric and boolean fields of
+// runtime.MemStats and statistics of durations of the recent garbage collector pauses
+func (ic *influxdbCollector) memstatsMetrics(ep *endpoint, raw json.RawMessage) []plugin.Metric {
+	fields := map[string]interface{}{}
+	if err := decodeResponse(raw, &fields); err != nil {
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "memstatsMetrics",
+			"instance": ep.instance,
+			"err":      err,
+		}).Warn("Cannot decode memstats of InfluxDB")
+		return nil
+	}
+	if !ic.filter.allowsSeries(moduleMemstats, nil) {
+		return nil
+	}
+
+	values := map[string]interface{}{}
+	for name, value := range fields {
+		switch value.(type) {
+		case json.Number, bool:
+			values[name] = typedValue(value)
+		}
+	}
+	numGC, _ := values["NumGC"].(int64)
+	if pauses, ok := fields["PauseNs"].([]interface{}); ok {
+		for name, value := range pauseStatistics(pauses, numGC) {
+			values[name] = value
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if ic.filter.allowsColumn(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	tags := withInstance(nil, ep.instance)
+	mts := make([]plugin.Metric, 0, len(names))
+	for _, name := range names {
+		mts = append(mts, plugin.Metric{
+			Namespace: statNamespace(moduleMemstats, nil, name),
+			Data:      values[name],
+			Tags:      tags,
+		})
+	}
+	return mts
+}
+
+// pauseStatistics returns statistics of durations of the recent garbage collector pauses given by memstats `PauseNs`,
+// a circular buffer holding durations of the last `numGC` pauses (at most 256 of them)
+func pauseStatistics(pauseNs []interface{}, numGC int64) map[string]interface{} {
+	if numGC <= 0 || len(pauseNs) == 0 {
+		return nil
+	}
+	count := int(numGC)
+	if count > len(pauseNs) {
+		count = len(pauseNs)
+	}
+	pauses := make([]int64, 0, count)
+	for i := 0; i < count; i++ {
+		// the most recent pause is at index (numGC+255)%256
+		idx := int((numGC - 1 - int64(i)) % int64(len(pauseNs)))
+		pause, ok := typedValue(pauseNs[idx]).(int64)
+		if !ok {
+			return nil
+		}
+		pauses = append(pauses, pause)
+	}
+
+	res := map[string]interface{}{"PauseNsLast": pauses[0]}
+	sort.Sort(int64Slice(pauses))
+	res["PauseNsMax"] = pauses[len(pauses)-1]
+	for _, q := range []int{50, 90, 99} {
+		// nearest-rank quantile
+		rank := (q*len(pauses) + 99) / 100
+		res[fmt.Sprintf("PauseNsP%d", q)] = pauses[rank-1]
+	}
+	return res
+}
+
+// int64Slice attaches the methods of sort.Interface to []int64, sorting in increasing order
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
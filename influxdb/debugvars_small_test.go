@@ -0,0 +1,204 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// mockDebugVars returns response of /debug/vars of InfluxDB which completed 3 garbage collections
+func mockDebugVars() string {
+	pauses := make([]string, 256)
+	for i := range pauses {
+		pauses[i] = "0"
+	}
+	pauses[0], pauses[1], pauses[2] = "300000", "100000", "200000"
+	return fmt.Sprintf(`{
+"cmdline": ["influxd"],
+"cq": {"name":"cq","tags":{},"values":{"queryFail":0,"queryOk":2}},
+"database:_internal": {"name":"database","tags":{"database":"_internal"},"values":{"numMeasurements":12,"numSeries":50}},
+"httpd::8086": {"name":"httpd","tags":{"bind":":8086"},"values":{"req":1120,"reqActive":1,"writeReq":300}},
+"memstats": {"Alloc":4509056,"TotalAlloc":43560664,"Sys":13109496,"NextGC":8388608,"LastGC":1485074326000000000,"NumGC":3,"GCCPUFraction":0.0012,"EnableGC":true,"DebugGC":false,
+	"PauseNs":[%s],"PauseEnd":[0],"BySize":[{"Size":0,"Mallocs":0,"Frees":0}]},
+"runtime": {"name":"runtime","tags":{},"values":{"Alloc":4509056,"NumGoroutine":42,"TotalAlloc":43560664}},
+"shard:1": {"name":"shard","tags":{"database":"_internal","engine":"tsm1","id":"1","path":"/var/lib/influxdb/data/_internal/monitor/1","retentionPolicy":"monitor"},"values":{"diskBytes":1024,"writePointsOk":512}}
+}`, strings.Join(pauses, ","))
+}
+
+func getDebugVarsMockHTTPResponse(ctx context.Context, url string) ([]byte, error) {
+	if strings.HasPrefix(url, "debug/vars") {
+		return []byte(mockDebugVars()), nil
+	}
+	if strings.HasPrefix(url, "diagnostics") {
+		return []byte(mockDiagnosticResults), nil
+	}
+	return nil, errors.New("SHOW STATS is not expected")
+}
+
+func newMockDebugVarsCollector() *influxdbCollector {
+	ep := newMockEndpoint("stats", "diagnostics")
+	ep.urlDebugVars = &url.URL{Path: "debug/vars"}
+	ic := &influxdbCollector{
+		getResponse: getDebugVarsMockHTTPResponse,
+		endpoints:   []*endpoint{ep},
+	}
+	ic.sources = []source{diagnosticsSource{ic}, debugVarsSource{ic}}
+	return ic
+}
+
+func TestDebugVars(t *testing.T) {
+	Convey("Collecting statistics from /debug/vars", t, func() {
+		influxdbPlugin := newMockDebugVarsCollector()
+		values := func(modules []string) map[string]interface{} {
+			plan := queryPlan{statistics: true, modules: modules}
+			mts, err := debugVarsSource{influxdbPlugin}.Collect(context.Background(), influxdbPlugin.endpoints[0], plan)
+			So(err, ShouldBeNil)
+			res := map[string]interface{}{}
+			for _, mt := range mts {
+				So(mt.Tags[tagInstance], ShouldEqual, "hostname:1234")
+				res[mt.Namespace.String()] = mt.Data
+			}
+			return res
+		}
+
+		Convey("maps statistics into namespace of SHOW STATS", func() {
+			res := values(nil)
+			So(res["/intel/influxdb/stat/httpd/req"], ShouldEqual, int64(1120))
+			So(res["/intel/influxdb/stat/cq/queryOk"], ShouldEqual, int64(2))
+			So(res["/intel/influxdb/stat/runtime/NumGoroutine"], ShouldEqual, int64(42))
+			So(res["/intel/influxdb/stat/database/_internal/numSeries"], ShouldEqual, int64(50))
+			So(res["/intel/influxdb/stat/shard/tsm1/_internal/monitor/1/writePointsOk"], ShouldEqual, int64(512))
+			So(res, ShouldNotContainKey, "/intel/influxdb/stat/cmdline")
+		})
+		Convey("adds statistics of memstats", func() {
+			res := values(nil)
+			So(res["/intel/influxdb/stat/memstats/NextGC"], ShouldEqual, int64(8388608))
+			So(res["/intel/influxdb/stat/memstats/GCCPUFraction"], ShouldEqual, 0.0012)
+			So(res["/intel/influxdb/stat/memstats/EnableGC"], ShouldEqual, true)
+			So(res["/intel/influxdb/stat/memstats/PauseNsLast"], ShouldEqual, int64(200000))
+			So(res["/intel/influxdb/stat/memstats/PauseNsMax"], ShouldEqual, int64(300000))
+			So(res["/intel/influxdb/stat/memstats/PauseNsP50"], ShouldEqual, int64(200000))
+			So(res, ShouldNotContainKey, "/intel/influxdb/stat/memstats/PauseNs")
+			So(res, ShouldNotContainKey, "/intel/influxdb/stat/memstats/BySize")
+		})
+		Convey("returns only requested modules", func() {
+			res := values([]string{"httpd", "memstats"})
+			So(res, ShouldContainKey, "/intel/influxdb/stat/httpd/req")
+			So(res, ShouldContainKey, "/intel/influxdb/stat/memstats/NextGC")
+			So(res, ShouldNotContainKey, "/intel/influxdb/stat/cq/queryOk")
+			So(res, ShouldNotContainKey, "/intel/influxdb/stat/runtime/NumGoroutine")
+		})
+		Convey("applies filters to memstats", func() {
+			var err error
+			influxdbPlugin.filter.columns, err = newPatternFilter("", "PauseNs*")
+			So(err, ShouldBeNil)
+			res := values(nil)
+			So(res, ShouldContainKey, "/intel/influxdb/stat/memstats/NextGC")
+			So(res, ShouldNotContainKey, "/intel/influxdb/stat/memstats/PauseNsLast")
+
+			influxdbPlugin.filter.modules, err = newPatternFilter("", "memstats")
+			So(err, ShouldBeNil)
+			res = values(nil)
+			So(res, ShouldNotContainKey, "/intel/influxdb/stat/memstats/NextGC")
+			So(res, ShouldContainKey, "/intel/influxdb/stat/httpd/req")
+		})
+		Convey("records the request in metrics of collector", func() {
+			values(nil)
+			stats := map[string]interface{}{}
+			for _, mt := range influxdbPlugin.endpoints[0].scrapes.metrics("hostname:1234") {
+				stats[mt.Namespace.String()] = mt.Data
+			}
+			So(stats["/intel/influxdb/collector/debug_vars/response_bytes"], ShouldEqual, int64(len(mockDebugVars())))
+			So(stats["/intel/influxdb/collector/debug_vars/series"], ShouldEqual, int64(6))
+			So(stats, ShouldNotContainKey, "/intel/influxdb/collector/stats/response_bytes")
+		})
+	})
+
+	Convey("Collecting metrics from /debug/vars", t, func() {
+		influxdbPlugin := newMockDebugVarsCollector()
+		results, err := influxdbPlugin.CollectMetrics([]plugin.Metric{
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "memstats", "*")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "diagn", "system", "PID")},
+		})
+		So(err, ShouldBeNil)
+		namespaces := map[string]bool{}
+		for _, mt := range results {
+			namespaces[mt.Namespace.String()] = true
+		}
+		So(namespaces["/intel/influxdb/stat/memstats/TotalAlloc"], ShouldBeTrue)
+		So(namespaces["/intel/influxdb/diagn/system/PID"], ShouldBeTrue)
+
+		Convey("exposes metric types of memstats with their metadata", func() {
+			mts, err := influxdbPlugin.GetMetricTypes(getMockConfig())
+			So(err, ShouldBeNil)
+			types := map[string]plugin.Metric{}
+			for _, mt := range mts {
+				types[mt.Namespace.String()] = mt
+			}
+			So(types["/intel/influxdb/stat/memstats/NextGC"].Unit, ShouldEqual, unitBytes)
+			So(types["/intel/influxdb/stat/memstats/PauseNsP99"].Description, ShouldContainSubstring, "99th percentile")
+			So(types, ShouldContainKey, "/intel/influxdb/stat/memstats/NumGC/rate")
+			So(types, ShouldNotContainKey, "/intel/influxdb/stat/memstats/NextGC/rate")
+		})
+	})
+
+	Convey("Getting statistics of garbage collector pauses", t, func() {
+		number := func(values ...int) []interface{} {
+			res := []interface{}{}
+			for _, v := range values {
+				res = append(res, json.Number(fmt.Sprint(v)))
+			}
+			return res
+		}
+
+		Convey("skips slots of buffer not used yet", func() {
+			res := pauseStatistics(number(10, 30, 20, 0, 0), 3)
+			So(res["PauseNsLast"], ShouldEqual, int64(20))
+			So(res["PauseNsMax"], ShouldEqual, int64(30))
+			So(res["PauseNsP50"], ShouldEqual, int64(20))
+			So(res["PauseNsP99"], ShouldEqual, int64(30))
+		})
+		Convey("wraps around the buffer", func() {
+			res := pauseStatistics(number(60, 70, 30, 40, 50), 7)
+			So(res["PauseNsLast"], ShouldEqual, int64(70))
+			So(res["PauseNsMax"], ShouldEqual, int64(70))
+			So(res["PauseNsP50"], ShouldEqual, int64(50))
+			So(res["PauseNsP90"], ShouldEqual, int64(70))
+		})
+		Convey("returns nothing before the first collection", func() {
+			So(pauseStatistics(number(0, 0), 0), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Initializing plugin with invalid source", t, func() {
+		influxdbPlugin := &influxdbCollector{getResponse: getMockHTTPResponse}
+		cfg := getMockConfig()
+		cfg["source"] = "expvar"
+		err := influxdbPlugin.init(cfg)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "Invalid source")
+	})
+}
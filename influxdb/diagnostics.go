@@ -1,5 +1,11 @@
 package influxdb
 
+import (
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
 type diagnostics struct {
 	Results []struct {
 		Series []struct {
@@ -7,5 +13,81 @@ type diagnostics struct {
 			Columns []string        `json:"columns"`
 			Values  [][]interface{} `json:"values"`
 		} `json:"series"`
+		Error string `json:"error,omitempty"`
 	} `json:"results"`
+	Error string `json:"error,omitempty"`
+}
+
+// err returns error reported by InfluxDB for the query or any of its statements
+func (d diagnostics) err() error {
+	if d.Error != "" {
+		return &queryError{message: d.Error}
+	}
+	for _, result := range d.Results {
+		if result.Error != "" {
+			return &queryError{message: result.Error}
+		}
+	}
+	return nil
+}
+
+// parseSystemTime returns time of diagnostic `system/<column>` found in `mts`, given as RFC3339 timestamp
+func parseSystemTime(mts []plugin.Metric, column string) (time.Time, bool) {
+	value, ok := systemDiagnostic(mts, column).(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	return t, err == nil
+}
+
+// systemTimeDiagnostics returns numeric companions of timestamps of diagnostics `mts` fetched between
+// `requested` and `received`: start of the process as unix time and skew of InfluxDB clock against the collector's one
+func systemTimeDiagnostics(mts []plugin.Metric, instance string, requested time.Time, received time.Time) []plugin.Metric {
+	res := []plugin.Metric{}
+	tags := withInstance(nil, instance)
+	if started, ok := parseSystemTime(mts, "started"); ok {
+		res = append(res, plugin.Metric{
+			Namespace: plugin.NewNamespace(nsVendor, nsClass, nsTypeDiagn, "system", "started_unix"),
+			Data:      started.Unix(),
+			Tags:      tags,
+		})
+	}
+	if current, ok := parseSystemTime(mts, "currentTime"); ok {
+		// the current time was read by InfluxDB somewhere during the request, the middle of it is the best estimate
+		collector := requested.Add(received.Sub(requested) / 2)
+		res = append(res, plugin.Metric{
+			Namespace: plugin.NewNamespace(nsVendor, nsClass, nsTypeDiagn, "system", "clock_skew_seconds"),
+			Data:      current.Sub(collector).Seconds(),
+			Tags:      tags,
+		})
+	}
+	return res
+}
+
+// withUptime returns copy of diagnostics `mts` fetched at `fetched` with uptime of the process in seconds at time `now`,
+// it is computed from the start of the process, or from the reported uptime and the time elapsed since diagnostics
+// were fetched, so it stays up to date while diagnostics are cached
+func withUptime(mts []plugin.Metric, instance string, fetched time.Time, now time.Time) []plugin.Metric {
+	var uptime float64
+	if started, ok := parseSystemTime(mts, "started"); ok {
+		skew, _ := systemDiagnostic(mts, "clock_skew_seconds").(float64)
+		uptime = now.Sub(started).Seconds() + skew
+	} else if value, ok := systemDiagnostic(mts, "uptime").(string); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return mts
+		}
+		uptime = (d + now.Sub(fetched)).Seconds()
+	} else {
+		return mts
+	}
+
+	res := make([]plugin.Metric, len(mts), len(mts)+1)
+	copy(res, mts)
+	return append(res, plugin.Metric{
+		Namespace: plugin.NewNamespace(nsVendor, nsClass, nsTypeDiagn, "system", "uptime_seconds"),
+		Data:      uptime,
+		Tags:      withInstance(nil, instance),
+	})
 }
@@ -0,0 +1,106 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// tagInstance is the name of metric tag holding address of InfluxDB instance the metric comes from
+const tagInstance = "instance"
+
+// endpoint holds URLs used to monitor a single InfluxDB instance
+type endpoint struct {
+	// instance is the address of InfluxDB instance in form host:port
+	instance      string
+	urlStatistic  *url.URL
+	urlDiagnostic *url.URL
+	urlPing       *url.URL
+	urlDebugVars  *url.URL
+	urlMetrics    *url.URL
+	diagnostics   diagnosticsCache
+	// counters holds previous samples of statistics used to compute their rates and deltas
+	counters counterStore
+	// scrapes holds metrics of collecting from the instance
+	scrapes scrapeStats
+	// modulesUnsupported is set when the instance does not support `SHOW STATS FOR` statement
+	modulesUnsupported int32
+}
+
+// statisticsURL returns URL of query for statistics of given modules, or all of them when `modules` is empty
+// or the instance does not support module-scoped statements
+func (ep *endpoint) statisticsURL(modules []string) string {
+	if len(modules) == 0 || atomic.LoadInt32(&ep.modulesUnsupported) != 0 {
+		return ep.urlStatistic.String()
+	}
+	u := *ep.urlStatistic
+	q := u.Query()
+	q.Set("q", statsStatement(modules))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// parseHosts returns addresses (host:port) of InfluxDB instances given as a comma separated list,
+// `port` is used for items without explicit port; when `hosts` is empty, address of `host` is returned
+func parseHosts(hosts string, host string, port int64) ([]string, error) {
+	if strings.TrimSpace(hosts) == "" {
+		return []string{net.JoinHostPort(host, strconv.FormatInt(port, 10))}, nil
+	}
+
+	addresses := []string{}
+	for _, item := range strings.Split(hosts, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		h, p, err := net.SplitHostPort(item)
+		if err != nil {
+			// item has no port
+			h, p = strings.Trim(item, "[]"), strconv.FormatInt(port, 10)
+		}
+		if h == "" {
+			return nil, fmt.Errorf("Invalid InfluxDB address `%s`, hostname is empty", item)
+		}
+		if _, err := strconv.ParseUint(p, 10, 16); err != nil {
+			return nil, fmt.Errorf("Invalid InfluxDB address `%s`, port must be a number", item)
+		}
+
+		address := net.JoinHostPort(h, p)
+		if !containsString(addresses, address) {
+			addresses = append(addresses, address)
+		}
+	}
+
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("Invalid list of InfluxDB hosts `%s`", hosts)
+	}
+	return addresses, nil
+}
+
+// withInstance returns copy of `tags` with the instance tag added
+func withInstance(tags map[string]string, instance string) map[string]string {
+	res := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		res[k] = v
+	}
+	res[tagInstance] = instance
+	return res
+}
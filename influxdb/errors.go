@@ -0,0 +1,108 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxErrorMessageLength limits the length of response body reported in errors
+const maxErrorMessageLength = 256
+
+// responseError is returned when InfluxDB responds with non-2xx status code
+type responseError struct {
+	statusCode int
+	// message is the error reported by InfluxDB in the body of response
+	message string
+}
+
+// newResponseError returns error for response with status code `statusCode` and body `body`
+func newResponseError(statusCode int, body []byte) *responseError {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	message := ""
+	if err := json.Unmarshal(body, &payload); err == nil {
+		message = payload.Error
+	} else {
+		message = strings.TrimSpace(string(body))
+		if len(message) > maxErrorMessageLength {
+			message = message[:maxErrorMessageLength] + "..."
+		}
+	}
+	return &responseError{statusCode: statusCode, message: message}
+}
+
+func (e *responseError) Error() string {
+	var kind string
+	switch {
+	case e.statusCode == http.StatusUnauthorized || e.statusCode == http.StatusForbidden:
+		kind = "Authorization failed"
+	case e.statusCode == http.StatusNotFound:
+		kind = "Not found"
+	case e.statusCode >= http.StatusInternalServerError:
+		kind = "InfluxDB server error"
+	default:
+		kind = "Unexpected response"
+	}
+
+	msg := fmt.Sprintf("%s, InfluxDB responded with status %d %s", kind, e.statusCode, http.StatusText(e.statusCode))
+	if e.message != "" {
+		msg += ": " + e.message
+	}
+	return msg
+}
+
+// queryError is returned when InfluxDB reports an error of executed statement
+type queryError struct {
+	message string
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("InfluxDB query failed: %s", e.message)
+}
+
+// isAuthError checks if `err` is caused by rejected credentials
+func isAuthError(err error) bool {
+	e, ok := err.(*responseError)
+	return ok && (e.statusCode == http.StatusUnauthorized || e.statusCode == http.StatusForbidden)
+}
+
+// isNotFoundError checks if `err` is caused by unknown API endpoint
+func isNotFoundError(err error) bool {
+	e, ok := err.(*responseError)
+	return ok && e.statusCode == http.StatusNotFound
+}
+
+// isServerError checks if `err` is caused by internal error of InfluxDB
+func isServerError(err error) bool {
+	e, ok := err.(*responseError)
+	return ok && e.statusCode >= http.StatusInternalServerError
+}
+
+// isStatementError checks if `err` is caused by statement which InfluxDB cannot parse or execute
+func isStatementError(err error) bool {
+	e, ok := err.(*responseError)
+	return isQueryError(err) || (ok && e.statusCode == http.StatusBadRequest)
+}
+
+// isQueryError checks if `err` is an error of statement reported by InfluxDB
+func isQueryError(err error) bool {
+	_, ok := err.(*queryError)
+	return ok
+}
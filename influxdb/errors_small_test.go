@@ -0,0 +1,95 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResponseErrors(t *testing.T) {
+	Convey("Getting response from InfluxDB", t, func() {
+		status := http.StatusOK
+		body := mockStatResults
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+		defer ts.Close()
+
+		ic := &influxdbCollector{}
+
+		Convey("succeeds for 2xx status", func() {
+			response, err := ic.getHttpResponse(context.Background(), ts.URL)
+			So(err, ShouldBeNil)
+			So(string(response), ShouldEqual, mockStatResults)
+		})
+		Convey("reports authorization failure with InfluxDB error message", func() {
+			status = http.StatusUnauthorized
+			body = `{"error":"authorization failed"}`
+			response, err := ic.getHttpResponse(context.Background(), ts.URL)
+			So(response, ShouldBeNil)
+			So(isAuthError(err), ShouldBeTrue)
+			So(isServerError(err), ShouldBeFalse)
+			So(err.Error(), ShouldContainSubstring, "Authorization failed")
+			So(err.Error(), ShouldContainSubstring, "authorization failed")
+		})
+		Convey("reports unknown endpoint", func() {
+			status = http.StatusNotFound
+			body = "404 page not found\n"
+			_, err := ic.getHttpResponse(context.Background(), ts.URL)
+			So(isNotFoundError(err), ShouldBeTrue)
+			So(err.Error(), ShouldEndWith, "404 page not found")
+		})
+		Convey("reports server error", func() {
+			status = http.StatusInternalServerError
+			body = strings.Repeat("x", 2*maxErrorMessageLength)
+			_, err := ic.getHttpResponse(context.Background(), ts.URL)
+			So(isServerError(err), ShouldBeTrue)
+			So(len(err.Error()), ShouldBeLessThan, 2*maxErrorMessageLength)
+		})
+	})
+
+	Convey("Collecting metrics", t, func() {
+		Convey("fails when InfluxDB reports an error of statement", func() {
+			influxdbPlugin := &influxdbCollector{
+				getResponse: func(ctx context.Context, url string) ([]byte, error) {
+					return []byte(`{"results":[{"statement_id":0,"error":"error authorizing query: test not authorized to execute statement 'SHOW STATS', requires admin privilege"}]}`), nil
+				},
+				endpoints: []*endpoint{newMockEndpoint("stats", "diagnostics")},
+			}
+			_, err := influxdbPlugin.CollectMetrics(mockMts)
+			So(isQueryError(err), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "requires admin privilege")
+		})
+		Convey("fails when InfluxDB reports an error of query", func() {
+			influxdbPlugin := &influxdbCollector{
+				getResponse: func(ctx context.Context, url string) ([]byte, error) {
+					return []byte(`{"error":"error parsing query: found EOF"}`), nil
+				},
+				endpoints: []*endpoint{newMockEndpoint("stats", "diagnostics")},
+			}
+			_, err := influxdbPlugin.CollectMetrics(mockMts)
+			So(isQueryError(err), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,137 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// pattern matches names either by glob (e.g. `tsm1_*`) or by regular expression given between slashes (e.g. `/^tsm1_(cache|wal)$/`)
+type pattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// newPattern returns pattern parsed from `expr`
+func newPattern(expr string) (pattern, error) {
+	if len(expr) > 1 && strings.HasPrefix(expr, "/") && strings.HasSuffix(expr, "/") {
+		re, err := regexp.Compile(expr[1 : len(expr)-1])
+		if err != nil {
+			return pattern{}, err
+		}
+		return pattern{re: re}, nil
+	}
+	if _, err := path.Match(expr, ""); err != nil {
+		return pattern{}, err
+	}
+	return pattern{glob: expr}, nil
+}
+
+func (p pattern) match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	ok, _ := path.Match(p.glob, name)
+	return ok
+}
+
+// patternFilter allows names matching any of include patterns (or all names when there are none)
+// unless they match any of exclude patterns
+type patternFilter struct {
+	include []pattern
+	exclude []pattern
+}
+
+// newPatternFilter returns filter of comma separated lists of include and exclude patterns
+func newPatternFilter(include string, exclude string) (patternFilter, error) {
+	var f patternFilter
+	var err error
+	if f.include, err = parsePatterns(include); err != nil {
+		return f, err
+	}
+	f.exclude, err = parsePatterns(exclude)
+	return f, err
+}
+
+// parsePatterns returns patterns given as a comma separated list
+func parsePatterns(list string) ([]pattern, error) {
+	patterns := []pattern{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		p, err := newPattern(item)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern `%s`, err=%s", item, err.Error())
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// allows checks if `name` passes the filter
+func (f patternFilter) allows(name string) bool {
+	for _, p := range f.exclude {
+		if p.match(name) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if p.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// statsFilter selects statistics turned into metrics by module, tags identifying the series and column
+type statsFilter struct {
+	modules patternFilter
+	// tags holds filters of series tags (database, retentionPolicy, id), series without the tag are not filtered by it
+	tags    map[string]patternFilter
+	columns patternFilter
+}
+
+// filteredTags maps series tags which can be filtered to the names of their config items (include_<name>, exclude_<name>)
+var filteredTags = map[string]string{
+	"database":        "databases",
+	"retentionPolicy": "retention_policies",
+	"id":              "shards",
+}
+
+// allowsSeries checks if statistics of series of module `module` identified by `tags` pass the filter
+func (f statsFilter) allowsSeries(module string, tags map[string]string) bool {
+	if !f.modules.allows(module) {
+		return false
+	}
+	for tag, filter := range f.tags {
+		if value, ok := tags[tag]; ok && !filter.allows(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// allowsColumn checks if statistic `column` passes the filter
+func (f statsFilter) allowsColumn(column string) bool {
+	return f.columns.allows(column)
+}
@@ -0,0 +1,134 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPatternFilter(t *testing.T) {
+	Convey("Matching patterns", t, func() {
+		p, err := newPattern("tsm1_*")
+		So(err, ShouldBeNil)
+		So(p.match("tsm1_cache"), ShouldBeTrue)
+		So(p.match("shard"), ShouldBeFalse)
+
+		p, err = newPattern("/^(shard|tsm1_wal)$/")
+		So(err, ShouldBeNil)
+		So(p.match("tsm1_wal"), ShouldBeTrue)
+		So(p.match("tsm1_cache"), ShouldBeFalse)
+
+		_, err = newPattern("/(/")
+		So(err, ShouldNotBeNil)
+		_, err = newPattern("[")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Filtering names", t, func() {
+		Convey("allows all names without patterns", func() {
+			f, err := newPatternFilter("", "")
+			So(err, ShouldBeNil)
+			So(f.allows("anything"), ShouldBeTrue)
+		})
+		Convey("allows only included names", func() {
+			f, err := newPatternFilter("snap, telegraf*", "")
+			So(err, ShouldBeNil)
+			So(f.allows("snap"), ShouldBeTrue)
+			So(f.allows("telegraf_test"), ShouldBeTrue)
+			So(f.allows("_internal"), ShouldBeFalse)
+		})
+		Convey("excludes names even if they are included", func() {
+			f, err := newPatternFilter("*", "_*")
+			So(err, ShouldBeNil)
+			So(f.allows("snap"), ShouldBeTrue)
+			So(f.allows("_internal"), ShouldBeFalse)
+		})
+		Convey("reports invalid patterns", func() {
+			_, err := newPatternFilter("snap", "/[/")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Invalid pattern `/[/`")
+		})
+	})
+}
+
+func TestStatsFilter(t *testing.T) {
+	Convey("Collecting filtered statistics", t, func() {
+		influxdbPlugin := &influxdbCollector{
+			getResponse: getMockHTTPResponse,
+			endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
+		}
+		collect := func(cfg plugin.Config) map[string]bool {
+			var err error
+			influxdbPlugin.filter, err = getStatsFilter(cfg)
+			So(err, ShouldBeNil)
+			mts, err := influxdbPlugin.getStatistics(context.Background(), influxdbPlugin.endpoints[0], nil)
+			So(err, ShouldBeNil)
+			res := map[string]bool{}
+			for _, mt := range mts {
+				res[mt.Namespace.String()] = true
+			}
+			return res
+		}
+
+		Convey("by module", func() {
+			mts := collect(plugin.Config{"exclude_modules": "tsm1_*, /^(runtime|database)$/"})
+			So(mts["/intel/influxdb/stat/httpd/req"], ShouldBeTrue)
+			So(mts["/intel/influxdb/stat/shard/tsm1/snap/autogen/1/writeReq"], ShouldBeTrue)
+			So(mts["/intel/influxdb/stat/tsm1_cache/tsm1/snap/autogen/1/memBytes"], ShouldBeFalse)
+			So(mts["/intel/influxdb/stat/runtime/HeapAlloc"], ShouldBeFalse)
+			So(mts["/intel/influxdb/stat/database/snap/numSeries"], ShouldBeFalse)
+		})
+		Convey("by database, retention policy and shard", func() {
+			mts := collect(plugin.Config{"include_databases": "snap"})
+			So(mts["/intel/influxdb/stat/shard/tsm1/snap/autogen/1/writeReq"], ShouldBeTrue)
+			So(mts["/intel/influxdb/stat/shard/tsm1/_internal/monitor/2/writeReq"], ShouldBeFalse)
+			So(mts["/intel/influxdb/stat/database/_internal/numSeries"], ShouldBeFalse)
+			So(mts["/intel/influxdb/stat/httpd/req"], ShouldBeTrue)
+
+			mts = collect(plugin.Config{"exclude_retention_policies": "monitor"})
+			So(mts["/intel/influxdb/stat/shard/tsm1/snap/autogen/1/writeReq"], ShouldBeTrue)
+			So(mts["/intel/influxdb/stat/shard/tsm1/_internal/monitor/2/writeReq"], ShouldBeFalse)
+
+			mts = collect(plugin.Config{"include_shards": "2"})
+			So(mts["/intel/influxdb/stat/shard/tsm1/snap/autogen/1/writeReq"], ShouldBeFalse)
+			So(mts["/intel/influxdb/stat/shard/tsm1/_internal/monitor/2/writeReq"], ShouldBeTrue)
+		})
+		Convey("by column", func() {
+			mts := collect(plugin.Config{"include_columns": "write*", "exclude_columns": "/Err$/"})
+			So(mts["/intel/influxdb/stat/shard/tsm1/snap/autogen/1/writeReq"], ShouldBeTrue)
+			So(mts["/intel/influxdb/stat/shard/tsm1/snap/autogen/1/writeReqErr"], ShouldBeFalse)
+			So(mts["/intel/influxdb/stat/httpd/req"], ShouldBeFalse)
+		})
+		Convey("still detecting restarts from excluded runtime statistics", func() {
+			collect(plugin.Config{"exclude_modules": "runtime"})
+			So(influxdbPlugin.endpoints[0].diagnostics.totalAlloc, ShouldBeGreaterThan, 0)
+		})
+	})
+
+	Convey("Initializing plugin with invalid filter", t, func() {
+		influxdbPlugin := &influxdbCollector{getResponse: getMockHTTPResponse}
+		cfg := getMockConfig()
+		cfg["include_databases"] = "/(/"
+		err := influxdbPlugin.init(cfg)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "Invalid filter of databases")
+	})
+}
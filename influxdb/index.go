@@ -0,0 +1,74 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"sort"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// metricIndex is a tree of collected metrics keyed by values of namespace elements,
+// it finds metrics matching requested namespace without comparing it with each collected metric
+type metricIndex struct {
+	children map[string]*metricIndex
+	// positions of metrics which namespace ends at this node
+	positions []int
+}
+
+// newMetricIndex returns index of metrics `mts`
+func newMetricIndex(mts []plugin.Metric) *metricIndex {
+	root := &metricIndex{}
+	for i, mt := range mts {
+		node := root
+		for _, e := range mt.Namespace {
+			if node.children == nil {
+				node.children = map[string]*metricIndex{}
+			}
+			child, ok := node.children[e.Value]
+			if !ok {
+				child = &metricIndex{}
+				node.children[e.Value] = child
+			}
+			node = child
+		}
+		node.positions = append(node.positions, i)
+	}
+	return root
+}
+
+// lookup returns positions of indexed metrics matching requested namespace `req` in ascending order,
+// namespaces match when they have the same length, wildcard in requested namespace matches any value
+func (idx *metricIndex) lookup(req plugin.Namespace) []int {
+	res := idx.find(req, nil)
+	sort.Ints(res)
+	return res
+}
+
+func (idx *metricIndex) find(req plugin.Namespace, res []int) []int {
+	if len(req) == 0 {
+		return append(res, idx.positions...)
+	}
+	if req[0].Value == nsWildcard {
+		for _, child := range idx.children {
+			res = child.find(req[1:], res)
+		}
+		return res
+	}
+	if child, ok := idx.children[req[0].Value]; ok {
+		return child.find(req[1:], res)
+	}
+	return res
+}
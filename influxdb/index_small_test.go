@@ -0,0 +1,147 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// mockShardColumns are statistics of generated shard series
+var mockShardColumns = []string{"fieldsCreate", "seriesCreate", "writePointsFail", "writePointsOk", "writeReq", "diskBytes"}
+
+// getMockShardsResponse returns response of `SHOW STATS` holding statistics of `count` shards
+func getMockShardsResponse(count int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"results":[{"series":[`)
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, `{"name":"shard","tags":{"database":"db%d","engine":"tsm1","id":"%d","retentionPolicy":"default"},"columns":["%s"],"values":[[%d,%d,%d,%d,%d,%d]]}`,
+			i%100, i, strings.Join(mockShardColumns, `","`), i, i, 0, i*10, i*2, i*1024)
+	}
+	buf.WriteString(`]}]}`)
+	return buf.Bytes()
+}
+
+func TestMetricIndex(t *testing.T) {
+	Convey("Looking up collected metrics", t, func() {
+		mts := []plugin.Metric{
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "req")},
+			{Namespace: statNamespace("shard", map[string]string{"engine": "tsm1", "database": "snap", "retentionPolicy": "default", "id": "1"}, "writePointsOk")},
+			{Namespace: statNamespace("shard", map[string]string{"engine": "tsm1", "database": "_internal", "retentionPolicy": "monitor", "id": "2"}, "writePointsOk")},
+			{Namespace: statNamespace("shard", map[string]string{"engine": "tsm1", "database": "snap", "retentionPolicy": "default", "id": "3"}, "writePointsOk")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "diagn", "system", "PID")},
+		}
+		idx := newMetricIndex(mts)
+
+		Convey("finds metric with static namespace", func() {
+			So(idx.lookup(plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "req")), ShouldResemble, []int{0})
+			So(idx.lookup(plugin.NewNamespace("intel", "influxdb", "diagn", "system", "PID")), ShouldResemble, []int{4})
+		})
+		Convey("finds all metrics matching dynamic elements in order of collection", func() {
+			So(idx.lookup(mockShardNamespace("writePointsOk")), ShouldResemble, []int{1, 2, 3})
+		})
+		Convey("finds metrics matching some of dynamic elements", func() {
+			ns := mockShardNamespace("writePointsOk")
+			ns[5].Value = "snap"
+			So(idx.lookup(ns), ShouldResemble, []int{1, 3})
+		})
+		Convey("finds metrics matching wildcards", func() {
+			So(idx.lookup(plugin.NewNamespace("intel", "influxdb", "*", "*", "*")), ShouldResemble, []int{0, 4})
+		})
+		Convey("finds nothing when namespace does not match", func() {
+			So(idx.lookup(plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "unknown")), ShouldBeEmpty)
+			So(idx.lookup(plugin.NewNamespace("intel", "influxdb", "stat", "httpd")), ShouldBeEmpty)
+			So(idx.lookup(plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "req", "*")), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Collecting metrics of many shards", t, func() {
+		response := getMockShardsResponse(1000)
+		influxdbPlugin := &influxdbCollector{
+			getResponse: func(ctx context.Context, url string) ([]byte, error) { return response, nil },
+			endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
+		}
+		ns := mockShardNamespace("writePointsOk")
+		ns[7].Value = "42"
+		results, err := influxdbPlugin.CollectMetrics([]plugin.Metric{
+			{Namespace: mockShardNamespace("writeReq")},
+			{Namespace: ns},
+		})
+		So(err, ShouldBeNil)
+		So(len(results), ShouldEqual, 1001)
+		So(results[1000].Namespace.String(), ShouldEqual, "/intel/influxdb/stat/shard/tsm1/db42/default/42/writePointsOk")
+		So(results[1000].Data, ShouldEqual, 420)
+	})
+}
+
+// benchmarkCollectMetrics measures collection of all statistics of `count` shards
+func benchmarkCollectMetrics(b *testing.B, count int) {
+	response := getMockShardsResponse(count)
+	influxdbPlugin := &influxdbCollector{
+		getResponse: func(ctx context.Context, url string) ([]byte, error) { return response, nil },
+		endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
+	}
+	mts := []plugin.Metric{}
+	for _, column := range mockShardColumns {
+		mts = append(mts, plugin.Metric{Namespace: mockShardNamespace(column)})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		results, err := influxdbPlugin.CollectMetrics(mts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(results) != count*len(mockShardColumns) {
+			b.Fatalf("collected %d metrics, expected %d", len(results), count*len(mockShardColumns))
+		}
+	}
+}
+
+func BenchmarkCollectMetrics1kSeries(b *testing.B)  { benchmarkCollectMetrics(b, 1000) }
+func BenchmarkCollectMetrics10kSeries(b *testing.B) { benchmarkCollectMetrics(b, 10000) }
+func BenchmarkCollectMetrics20kSeries(b *testing.B) { benchmarkCollectMetrics(b, 20000) }
+
+// BenchmarkMetricIndex measures lookup of each metric of 10k shards by its static namespace
+func BenchmarkMetricIndex(b *testing.B) {
+	mts := []plugin.Metric{}
+	for i := 0; i < 10000; i++ {
+		tags := map[string]string{"engine": "tsm1", "database": "db", "retentionPolicy": "default", "id": fmt.Sprint(i)}
+		for _, column := range mockShardColumns {
+			mts = append(mts, plugin.Metric{Namespace: statNamespace("shard", tags, column)})
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx := newMetricIndex(mts)
+		for _, mt := range mts {
+			if len(idx.lookup(mt.Namespace)) != 1 {
+				b.Fatal("metric not found")
+			}
+		}
+	}
+}
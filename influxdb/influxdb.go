@@ -15,15 +15,16 @@ limitations under the License.
 package influxdb
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
 	log "github.com/sirupsen/logrus"
 
-	"encoding/json"
 	"net/http"
 	"net/url"
 	"time"
@@ -33,13 +34,23 @@ const (
 	// Name of plugin
 	Name = "influxdb"
 	// Version of plugin
-	Version = 7
+	Version = 8
 
 	nsVendor = "intel"
 	nsClass  = "influxdb"
 
 	nsTypeStats = "stat"
 	nsTypeDiagn = "diagn"
+	// namespace of metrics describing the collection itself
+	nsTypeCollector = "collector"
+
+	defaultMaxConcurrency = 4
+	defaultTimeout        = 5 * time.Second
+	defaultRetries        = 2
+	defaultRetryBackoff   = 100 * time.Millisecond
+	defaultDiagnosticsTTL = time.Minute
+	defaultUser           = "admin"
+	defaultPassword       = "admin"
 )
 
 const (
@@ -51,20 +62,41 @@ const (
 // prefix in metric namespace
 var prefix = []string{nsVendor, nsClass}
 
-type getResponse func(url string) ([]byte, error)
+type getResponse func(ctx context.Context, url string) ([]byte, error)
 
 // influxdbCollector holds data retrieved from influxDB system monitoring
 type influxdbCollector struct {
-	urlStatistic  *url.URL
-	urlDiagnostic *url.URL
+	endpoints []*endpoint
+	client    *http.Client
+	auth      authOptions
+	// maxConcurrency limits the number of queries executed at the same time
+	maxConcurrency int
+	// collectTimeout is the deadline for collecting metrics from all instances, zero means no deadline
+	collectTimeout time.Duration
+	// retries is the number of times a request failed with a transient error is repeated
+	retries int
+	// retryBackoff is the delay before the first retry, doubled for each next one
+	retryBackoff time.Duration
+	// diagnosticsTTL is the time diagnostics are cached for, zero disables caching
+	diagnosticsTTL time.Duration
+	// normalizeNames enables conversion of statistics names reported by InfluxDB older than 1.0 to canonical ones
+	normalizeNames bool
+	// catalogMode tells how metric types are discovered: live, static or merged
+	catalogMode string
+	// filter selects statistics turned into metrics
+	filter statsFilter
+	// sources read metrics of InfluxDB instances, nil means the default ones
+	sources []source
 	getResponse
+	getPing getHeaders
 }
 
 // New returns new instance of snap-plugin-collector-influxdb
 func New() plugin.Collector {
-	return &influxdbCollector{
-		getResponse: getHttpResponse,
-	}
+	ic := &influxdbCollector{}
+	ic.getResponse = ic.getHttpResponse
+	ic.getPing = ic.getPingResponse
+	return ic
 }
 
 // GetConfigPolicy returns a ConfigPolicy
@@ -73,20 +105,86 @@ func (ic *influxdbCollector) GetConfigPolicy() (plugin.ConfigPolicy, error) {
 	cfgKey := []string{"intel", "influxdb"}
 	policy.AddNewStringRule(cfgKey, "host", false, plugin.SetDefaultString("localhost"))
 	policy.AddNewIntRule(cfgKey, "port", false, plugin.SetDefaultInt(8086))
-	policy.AddNewStringRule(cfgKey, "user", false, plugin.SetDefaultString("admin"))
-	policy.AddNewStringRule(cfgKey, "password", false, plugin.SetDefaultString("admin"))
+	policy.AddNewStringRule(cfgKey, "hosts", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule(cfgKey, "user", false, plugin.SetDefaultString(defaultUser))
+	policy.AddNewStringRule(cfgKey, "password", false, plugin.SetDefaultString(defaultPassword))
+	policy.AddNewStringRule(cfgKey, "auth_method", false, plugin.SetDefaultString(authBasic))
+	policy.AddNewStringRule(cfgKey, "token", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule(cfgKey, "scheme", false, plugin.SetDefaultString(schemeHTTP))
+	policy.AddNewStringRule(cfgKey, "ca_file", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule(cfgKey, "cert_file", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule(cfgKey, "key_file", false, plugin.SetDefaultString(""))
+	policy.AddNewStringRule(cfgKey, "server_name", false, plugin.SetDefaultString(""))
+	policy.AddNewBoolRule(cfgKey, "insecure_skip_verify", false, plugin.SetDefaultBool(false))
+	policy.AddNewIntRule(cfgKey, "max_concurrency", false, plugin.SetDefaultInt(defaultMaxConcurrency), plugin.SetMinInt(1))
+	policy.AddNewStringRule(cfgKey, "collect_timeout", false, plugin.SetDefaultString("0s"))
+	policy.AddNewStringRule(cfgKey, "timeout", false, plugin.SetDefaultString(defaultTimeout.String()))
+	policy.AddNewIntRule(cfgKey, "retries", false, plugin.SetDefaultInt(defaultRetries), plugin.SetMinInt(0))
+	policy.AddNewStringRule(cfgKey, "retry_backoff", false, plugin.SetDefaultString(defaultRetryBackoff.String()))
+	policy.AddNewStringRule(cfgKey, "diagnostics_ttl", false, plugin.SetDefaultString(defaultDiagnosticsTTL.String()))
+	policy.AddNewBoolRule(cfgKey, "normalize_names", false, plugin.SetDefaultBool(true))
+	policy.AddNewStringRule(cfgKey, "catalog_mode", false, plugin.SetDefaultString(catalogLive))
+	policy.AddNewBoolRule(cfgKey, "ping", false, plugin.SetDefaultBool(true))
+	policy.AddNewStringRule(cfgKey, "source", false, plugin.SetDefaultString(sourceStats))
+	policy.AddNewStringRule(cfgKey, "sources", false, plugin.SetDefaultString(""))
+	for _, name := range []string{"modules", "databases", "retention_policies", "shards", "columns"} {
+		policy.AddNewStringRule(cfgKey, "include_"+name, false, plugin.SetDefaultString(""))
+		policy.AddNewStringRule(cfgKey, "exclude_"+name, false, plugin.SetDefaultString(""))
+	}
 	return *policy, nil
 }
 
 // GetMetricTypes returns list of metrics based on influxDB system monitoring
 func (ic *influxdbCollector) GetMetricTypes(cfg plugin.Config) ([]plugin.Metric, error) {
-	if ic.urlDiagnostic == nil || ic.urlStatistic == nil {
+	if len(ic.endpoints) == 0 {
 		if err := ic.init(cfg); err != nil {
-			return nil, err
+			return nil, secrets.Error(err)
+		}
+	}
+
+	mts := []plugin.Metric{}
+	if ic.catalogMode != catalogStatic {
+		live, err := ic.getMetrics(discoveryPlan)
+		if err != nil && ic.catalogMode != catalogMerged {
+			return nil, secrets.Error(err)
 		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"block":    "monitor",
+				"function": "GetMetricTypes",
+				"err":      secrets.Error(err),
+			}).Warn("Cannot discover metrics of InfluxDB, returning metrics of the built-in catalog")
+		}
+		mts = append(mts, live...)
+	}
+	if ic.catalogMode == catalogStatic || ic.catalogMode == catalogMerged {
+		mts = append(mts, staticMetricTypes()...)
 	}
 
-	return ic.getMetrics()
+	// the same metric types are exposed by each of monitored instances, shards and databases
+	metricTypes := []plugin.Metric{}
+	known := map[string]bool{}
+	for _, mt := range mts {
+		mt.Namespace = metricType(mt.Namespace)
+		ns := mt.Namespace.String()
+		if known[ns] {
+			continue
+		}
+		known[ns] = true
+		metricTypes = append(metricTypes, withMetadata(mt))
+
+		// rates and deltas of counters are available since the second collection
+		elements := mt.Namespace.Strings()
+		if _, numeric := toFloat(mt.Data); numeric && elements[2] == nsTypeStats && isCounter(elements[3], elements[len(elements)-1]) {
+			for _, suffix := range []string{nsDelta, nsRate} {
+				derived := mt
+				derived.Namespace = derivedNamespace(mt.Namespace, suffix)
+				known[derived.Namespace.String()] = true
+				metricTypes = append(metricTypes, withMetadata(derived))
+			}
+		}
+	}
+	return metricTypes, nil
 }
 
 // CollectMetrics collects given metrics
@@ -95,28 +193,44 @@ func (ic *influxdbCollector) CollectMetrics(mts []plugin.Metric) ([]plugin.Metri
 	if len(mts) == 0 {
 		return nil, errors.New("No metrics requested")
 	}
-	if ic.urlDiagnostic == nil || ic.urlStatistic == nil {
-		ic.init(mts[0].Config)
+	if len(ic.endpoints) == 0 {
+		if err := ic.init(mts[0].Config); err != nil {
+			return nil, secrets.Error(err)
+		}
 	}
 
-	metrics, err := ic.getMetrics()
+	plan := newQueryPlan(mts, ic.diagnosticsTTL > 0)
+	metrics, err := ic.getMetrics(plan)
 	if err != nil {
-		return nil, err
+		if !plan.collector {
+			return nil, secrets.Error(err)
+		}
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "CollectMetrics",
+			"err":      secrets.Error(err),
+		}).Warn("Cannot collect metrics from any of InfluxDB instances, returning metrics of collector")
 	}
 
 	// return only requested metrics
 	ts := time.Now()
+	idx := newMetricIndex(metrics)
 	for _, req := range mts {
-		for _, metric := range metrics {
-			if reflect.DeepEqual(req.Namespace.Strings(), metric.Namespace.Strings()) {
-				// merge any new tags
-				for k, v := range metric.Tags {
-					req.Tags[k] = v
-				}
-				req.Data = metric.Data
-				req.Timestamp = ts
-				res = append(res, req)
+		for _, i := range idx.lookup(req.Namespace) {
+			metric := metrics[i]
+			mt := req
+			mt.Namespace = metric.Namespace
+			// merge any new tags, the same requested metric may be returned for many instances
+			mt.Tags = make(map[string]string, len(req.Tags)+len(metric.Tags))
+			for k, v := range req.Tags {
+				mt.Tags[k] = v
+			}
+			for k, v := range metric.Tags {
+				mt.Tags[k] = v
 			}
+			mt.Data = metric.Data
+			mt.Timestamp = ts
+			res = append(res, mt)
 		}
 	}
 
@@ -135,6 +249,16 @@ func (ic *influxdbCollector) init(cfg plugin.Config) error {
 		return fmt.Errorf("Cannot get a port from plugin config, err=%s", err.Error())
 	}
 
+	hosts, err := getConfigString(cfg, "hosts", "")
+	if err != nil {
+		return fmt.Errorf("Cannot get a list of hosts from plugin config, err=%s", err.Error())
+	}
+
+	addresses, err := parseHosts(hosts, host, port)
+	if err != nil {
+		return err
+	}
+
 	user, err := cfg.GetString("user")
 	if err != nil {
 		return fmt.Errorf("Cannot get a username from plugin config, err=%s", err.Error())
@@ -145,144 +269,653 @@ func (ic *influxdbCollector) init(cfg plugin.Config) error {
 		return fmt.Errorf("Cannot get a password from plugin config, err=%s", err.Error())
 	}
 
-	if err := ic.InitURLs(host, port, user, passwd); err != nil {
+	authMethod, err := getConfigString(cfg, "auth_method", authBasic)
+	if err != nil {
+		return fmt.Errorf("Cannot get an authentication method from plugin config, err=%s", err.Error())
+	}
+
+	token, err := getConfigString(cfg, "token", "")
+	if err != nil {
+		return fmt.Errorf("Cannot get a token from plugin config, err=%s", err.Error())
+	}
+
+	secrets.add(passwd, token)
+	ic.auth = authOptions{method: authMethod, user: user, password: passwd, token: token}
+	if err := ic.auth.validate(); err != nil {
 		return err
 	}
 
+	scheme, err := getConfigString(cfg, "scheme", schemeHTTP)
+	if err != nil {
+		return fmt.Errorf("Cannot get a scheme from plugin config, err=%s", err.Error())
+	}
+
+	tlsOpts, err := getTLSOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	timeout, err := getConfigDuration(cfg, "timeout", defaultTimeout)
+	if err != nil {
+		return fmt.Errorf("Cannot get a timeout from plugin config, err=%s", err.Error())
+	}
+
+	retries, err := getConfigInt(cfg, "retries", defaultRetries)
+	if err != nil {
+		return fmt.Errorf("Cannot get a number of retries from plugin config, err=%s", err.Error())
+	}
+	if retries < 0 {
+		return fmt.Errorf("Invalid number of retries %d, must not be negative", retries)
+	}
+	ic.retries = int(retries)
+
+	if ic.retryBackoff, err = getConfigDuration(cfg, "retry_backoff", defaultRetryBackoff); err != nil {
+		return fmt.Errorf("Cannot get retry_backoff from plugin config, err=%s", err.Error())
+	}
+
+	maxConcurrency, err := getConfigInt(cfg, "max_concurrency", defaultMaxConcurrency)
+	if err != nil {
+		return fmt.Errorf("Cannot get max_concurrency from plugin config, err=%s", err.Error())
+	}
+	if maxConcurrency < 1 {
+		return fmt.Errorf("Invalid max_concurrency %d, must be at least 1", maxConcurrency)
+	}
+	ic.maxConcurrency = int(maxConcurrency)
+
+	if ic.client, err = newHTTPClient(scheme, tlsOpts, timeout, ic.maxConcurrency); err != nil {
+		return err
+	}
+
+	if ic.collectTimeout, err = getConfigDuration(cfg, "collect_timeout", 0); err != nil {
+		return fmt.Errorf("Cannot get collect_timeout from plugin config, err=%s", err.Error())
+	}
+
+	if ic.diagnosticsTTL, err = getConfigDuration(cfg, "diagnostics_ttl", defaultDiagnosticsTTL); err != nil {
+		return fmt.Errorf("Cannot get diagnostics_ttl from plugin config, err=%s", err.Error())
+	}
+
+	if ic.normalizeNames, err = getConfigBool(cfg, "normalize_names", true); err != nil {
+		return fmt.Errorf("Cannot get normalize_names from plugin config, err=%s", err.Error())
+	}
+
+	if ic.catalogMode, err = getConfigString(cfg, "catalog_mode", catalogLive); err != nil {
+		return fmt.Errorf("Cannot get catalog_mode from plugin config, err=%s", err.Error())
+	}
+	switch ic.catalogMode {
+	case catalogLive, catalogStatic, catalogMerged:
+	default:
+		return fmt.Errorf("Invalid catalog_mode `%s`, must be one of: %s, %s, %s", ic.catalogMode, catalogLive, catalogStatic, catalogMerged)
+	}
+
+	if ic.filter, err = getStatsFilter(cfg); err != nil {
+		return err
+	}
+
+	ping, err := getConfigBool(cfg, "ping", true)
+	if err != nil {
+		return fmt.Errorf("Cannot get ping from plugin config, err=%s", err.Error())
+	}
+
+	statsSource, err := getConfigString(cfg, "source", sourceStats)
+	if err != nil {
+		return fmt.Errorf("Cannot get a source from plugin config, err=%s", err.Error())
+	}
+	switch statsSource {
+	case sourceStats, sourceDebugVars, sourcePrometheus:
+	default:
+		return fmt.Errorf("Invalid source `%s`, must be one of: %s, %s, %s", statsSource, sourceStats, sourceDebugVars, sourcePrometheus)
+	}
+
+	sources, err := getConfigString(cfg, "sources", "")
+	if err != nil {
+		return fmt.Errorf("Cannot get a list of sources from plugin config, err=%s", err.Error())
+	}
+	if strings.TrimSpace(sources) == "" {
+		sources = defaultSources(statsSource, ping)
+	}
+	if ic.sources, err = ic.newSources(sources); err != nil {
+		return err
+	}
+
+	if err := ic.InitURLs(scheme, addresses); err != nil {
+		return err
+	}
+
+	if ic.sourceEnabled(sourcePing) {
+		ic.probe()
+	}
+
 	log.WithFields(log.Fields{
-		"function": "init",
+		"function":  "init",
+		"instances": strings.Join(addresses, ","),
 	}).Info("Succeeded plugin initialization")
 	return nil
 }
 
-func (ic *influxdbCollector) getMetrics() ([]plugin.Metric, error) {
-	stats, err := ic.getStatistics()
-	if err != nil {
-		return nil, err
+// query is a single request for metrics of InfluxDB instance
+type query struct {
+	ep  *endpoint
+	get func(ctx context.Context, ep *endpoint) ([]plugin.Metric, error)
+	// probe is set for queries which gather no metrics of InfluxDB, their failures are only counted
+	probe bool
+}
+
+// getMetrics returns metrics of all monitored InfluxDB instances gathered by queries described by `plan`,
+// queries are executed concurrently, at most maxConcurrency at the same time;
+// when all of them fail, the error is returned together with metrics of collector
+func (ic *influxdbCollector) getMetrics(plan queryPlan) ([]plugin.Metric, error) {
+	ctx := context.Background()
+	if ic.collectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ic.collectTimeout)
+		defer cancel()
 	}
-	diags, err := ic.getDiagnostics()
-	if err != nil {
-		return nil, err
+
+	queries := []query{}
+	for _, ep := range ic.endpoints {
+		for _, src := range ic.enabledSources() {
+			if !src.Requested(plan) {
+				continue
+			}
+			_, probe := src.(prober)
+			queries = append(queries, query{ep, sourceQuery(src, plan), probe})
+		}
 	}
 
-	return append(diags, stats...), nil
+	limit := ic.maxConcurrency
+	if limit < 1 {
+		limit = defaultMaxConcurrency
+	}
+	semaphore := make(chan struct{}, limit)
+	results := make([][]plugin.Metric, len(queries))
+	errs := make([]error, len(queries))
+
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func(i int, q query) {
+			defer wg.Done()
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				errs[i] = fmt.Errorf("Cannot query %s, err=%s", q.ep.instance, ctx.Err().Error())
+				return
+			}
+			results[i], errs[i] = q.get(ctx, q.ep)
+		}(i, q)
+	}
+	wg.Wait()
+
+	// return metrics of queries which succeeded, failures are reported by metric of collection errors
+	mts := []plugin.Metric{}
+	failures := map[*endpoint]int{}
+	failed, probes := 0, 0
+	var firstErr error
+	for i, q := range queries {
+		if q.probe {
+			probes++
+		}
+		if errs[i] != nil {
+			failures[q.ep]++
+			if q.probe {
+				continue
+			}
+			failed++
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		mts = append(mts, results[i]...)
+	}
+
+	finished := time.Now()
+	for _, ep := range ic.endpoints {
+		ep.scrapes.finish(failures[ep] == 0, finished)
+	}
+
+	if failed == len(queries)-probes && firstErr != nil {
+		// metrics of collector are still returned, so failures of InfluxDB can be reported
+		return ic.collectorMetrics(failures), firstErr
+	}
+	if firstErr != nil {
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "getMetrics",
+			"failed":   failed,
+			"err":      firstErr,
+		}).Warn("Cannot collect metrics from some of InfluxDB instances, returning partial results")
+	}
+
+	return append(mts, ic.collectorMetrics(failures)...), nil
 }
 
-// getDiagnostics executes the command "SHOW DIAGNOSTICS" (indirectly)
-func (ic *influxdbCollector) getDiagnostics() ([]plugin.Metric, error) {
+// sourceQuery returns query of metrics requested by `plan` from source `src`, or of all metrics it exposes
+// when metric types are discovered
+func sourceQuery(src source, plan queryPlan) func(ctx context.Context, ep *endpoint) ([]plugin.Metric, error) {
+	if plan.discovery {
+		return src.MetricTypes
+	}
+	return func(ctx context.Context, ep *endpoint) ([]plugin.Metric, error) {
+		return src.Collect(ctx, ep, plan)
+	}
+}
+
+// collectorMetrics returns metrics of the collection from each of InfluxDB instances,
+// `failures` holds the number of failed queries per instance
+func (ic *influxdbCollector) collectorMetrics(failures map[*endpoint]int) []plugin.Metric {
+	mts := []plugin.Metric{}
+	for _, ep := range ic.endpoints {
+		tags := withInstance(nil, ep.instance)
+		restarts, reset := ep.diagnostics.reportRestarts()
+		mts = append(mts,
+			plugin.Metric{
+				Namespace: plugin.NewNamespace(nsVendor, nsClass, nsTypeCollector, "errors"),
+				Data:      int64(failures[ep]),
+				Tags:      tags,
+			},
+			plugin.Metric{
+				Namespace: plugin.NewNamespace(nsVendor, nsClass, nsTypeCollector, "restarts"),
+				Data:      restarts,
+				Tags:      tags,
+			},
+			plugin.Metric{
+				Namespace: plugin.NewNamespace(nsVendor, nsClass, nsTypeCollector, "counter_reset"),
+				Data:      reset,
+				Tags:      tags,
+			},
+		)
+		mts = append(mts, ep.scrapes.metrics(ep.instance)...)
+	}
+	return mts
+}
+
+// getDiagnostics executes the command "SHOW DIAGNOSTICS" (indirectly) against InfluxDB instance `ep`,
+// diagnostics are cached for diagnosticsTTL
+func (ic *influxdbCollector) getDiagnostics(ctx context.Context, ep *endpoint) ([]plugin.Metric, error) {
+	if mts, fetched, ok := ep.diagnostics.get(ic.diagnosticsTTL); ok {
+		return withUptime(mts, ep.instance, fetched, time.Now()), nil
+	}
+
 	mts := []plugin.Metric{}
 	var diag diagnostics
-	response, err := ic.getResponse(ic.urlDiagnostic.String())
+	requested := time.Now()
+	sc := scrape{}
+	defer func() {
+		sc.duration = time.Since(requested)
+		ep.scrapes.record(sourceDiagnostics, sc)
+	}()
+	response, err := ic.getResponse(ctx, ep.urlDiagnostic.String())
+	received := time.Now()
+	sc.bytes = len(response)
 	if err != nil {
-		log.Errorf("error getting response err=%v response=%v", err.Error(),
-			response)
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "getDiagnostics",
+			"instance": ep.instance,
+			"err":      err,
+		}).Error("Cannot get response from InfluxDB")
 		return nil, err
 	}
-	err = json.Unmarshal(response, &diag)
+	err = decodeResponse(response, &diag)
 	if err != nil {
 		return nil, err
 	}
+	if err := diag.err(); err != nil {
+		return nil, err
+	}
 	for _, result := range diag.Results {
+		sc.series += len(result.Series)
 		for _, series := range result.Series {
+			tags := withInstance(nil, ep.instance)
 			for _, values := range series.Values {
 				for idx, value := range values {
+					if value == nil {
+						continue
+					}
 					mts = append(mts, plugin.Metric{
 						Namespace: plugin.NewNamespace(nsVendor, nsClass,
 							nsTypeDiagn, series.Name, series.Columns[idx]),
-						Data: value,
+						Data: typedValue(value),
+						Tags: tags,
 					})
 				}
 			}
 		}
 	}
-	return mts, nil
+	mts = append(mts, systemTimeDiagnostics(mts, ep.instance, requested, received)...)
+	sc.metrics = len(mts)
+	if ep.diagnostics.set(mts) {
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "getDiagnostics",
+			"instance": ep.instance,
+		}).Info("InfluxDB process has been restarted")
+	}
+	return withUptime(mts, ep.instance, received, received), nil
 }
 
-// getStatistics executes the command "SHOW STATS" (indirectly)
-func (ic *influxdbCollector) getStatistics() ([]plugin.Metric, error) {
+// getStatistics executes the command "SHOW STATS" (indirectly) against InfluxDB instance `ep`,
+// only statistics of given modules are queried when the instance supports it
+func (ic *influxdbCollector) getStatistics(ctx context.Context, ep *endpoint, modules []string) ([]plugin.Metric, error) {
+	normalize := ic.legacyNames(ep)
+	mts, err := ic.queryStatistics(ctx, ep, modules, normalize)
+	if err != nil && len(modules) > 0 && isStatementError(err) && atomic.LoadInt32(&ep.modulesUnsupported) == 0 {
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "getStatistics",
+			"instance": ep.instance,
+			"err":      err,
+		}).Info("InfluxDB does not support statistics of selected modules, querying all of them")
+		atomic.StoreInt32(&ep.modulesUnsupported, 1)
+		return ic.queryStatistics(ctx, ep, nil, normalize)
+	}
+	return mts, err
+}
+
+// legacyNames checks if names of statistics reported by InfluxDB instance `ep` need to be normalised,
+// the version of InfluxDB is taken from the last diagnostics or ping, no query is sent to learn it
+func (ic *influxdbCollector) legacyNames(ep *endpoint) bool {
+	if !ic.normalizeNames {
+		return false
+	}
+	version := ep.diagnostics.version()
+	if version == "" {
+		version = ep.scrapes.lastPing().version
+	}
+	legacy, err := isLegacyVersion(version)
+	if err != nil {
+		// InfluxDB 1.x never reports snake_case names, so they can be normalised regardless of the version
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "legacyNames",
+			"instance": ep.instance,
+			"version":  version,
+		}).Debug("Cannot determine version of InfluxDB, normalising names of statistics")
+		return true
+	}
+	return legacy
+}
+
+// queryStatistics executes the command "SHOW STATS" for given modules against InfluxDB instance `ep`,
+// names of statistics are converted to canonical ones when `normalize` is set
+func (ic *influxdbCollector) queryStatistics(ctx context.Context, ep *endpoint, modules []string, normalize bool) ([]plugin.Metric, error) {
 	mts := []plugin.Metric{}
 	var stats stats
-	response, err := ic.getResponse(ic.urlStatistic.String())
+	start := time.Now()
+	sc := scrape{}
+	defer func() {
+		sc.duration = time.Since(start)
+		sc.metrics = len(mts)
+		ep.scrapes.record(sourceStats, sc)
+	}()
+	response, err := ic.getResponse(ctx, ep.statisticsURL(modules))
+	sc.bytes = len(response)
 	if err != nil {
-		log.Errorf("error getting response err=%v response=%v", err.Error(),
-			response)
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "getStatistics",
+			"instance": ep.instance,
+			"err":      err,
+		}).Error("Cannot get response from InfluxDB")
 		return nil, err
 	}
-	err = json.Unmarshal(response, &stats)
+	err = decodeResponse(response, &stats)
 	if err != nil {
 		return nil, err
 	}
+	if err := stats.err(); err != nil {
+		return nil, err
+	}
 	for _, result := range stats.Results {
-		for _, series := range result.Series {
-			for _, values := range series.Values {
-				for idx, value := range values {
-					mts = append(mts, plugin.Metric{
-						Namespace: plugin.NewNamespace(nsVendor, nsClass,
-							nsTypeStats, series.Name, series.Columns[idx]),
-						Data: value,
-						Tags: series.Tags,
-					})
+		sc.series += len(result.Series)
+		mts = append(mts, ic.seriesMetrics(ep, result.Series, normalize)...)
+	}
+	return mts, nil
+}
+
+// seriesMetrics returns metrics of statistics `list` of InfluxDB instance `ep` which pass the filter,
+// names of statistics are converted to canonical ones when `normalize` is set
+func (ic *influxdbCollector) seriesMetrics(ep *endpoint, list []statsSeries, normalize bool) []plugin.Metric {
+	mts := []plugin.Metric{}
+	for _, series := range list {
+		// series are filtered before metrics are built, runtime statistics are still needed to detect restarts
+		allowed := ic.filter.allowsSeries(series.Name, series.Tags)
+		if !allowed && series.Name != "runtime" {
+			continue
+		}
+		tags := withInstance(series.Tags, ep.instance)
+		for _, values := range series.Values {
+			for idx, value := range values {
+				if value == nil {
+					continue
+				}
+				column := series.Columns[idx]
+				if normalize {
+					column = canonicalStatistic(series.Name, column)
+				}
+				if series.Name == "runtime" && column == "TotalAlloc" {
+					if totalAlloc, ok := typedValue(value).(int64); ok && ep.diagnostics.observeTotalAlloc(totalAlloc) {
+						log.WithFields(log.Fields{
+							"block":    "monitor",
+							"function": "getStatistics",
+							"instance": ep.instance,
+						}).Info("InfluxDB process has been restarted")
+					}
+				}
+				if !allowed || !ic.filter.allowsColumn(column) {
+					continue
 				}
+				mts = append(mts, plugin.Metric{
+					Namespace: statNamespace(series.Name, series.Tags, column),
+					Data:      typedValue(value),
+					Tags:      tags,
+				})
 			}
 		}
 	}
-	return mts, nil
+	return mts
+}
+
+// InitURLs initializes URLs of InfluxDB instances given by `addresses` (host:port),
+// credentials are included only for query authentication method
+func (ic *influxdbCollector) InitURLs(scheme string, addresses []string) error {
+	endpoints := []*endpoint{}
+	for _, address := range addresses {
+		ep, err := ic.newEndpoint(scheme, address)
+		if err != nil {
+			return err
+		}
+		endpoints = append(endpoints, ep)
+	}
+	ic.endpoints = endpoints
+
+	return nil
 }
 
-// InitURLs initializes URLs based on settings
-func (ic *influxdbCollector) InitURLs(host string, port int64, user string, passwd string) error {
+// newEndpoint returns endpoint with initialized URLs of InfluxDB instance available under `address`
+func (ic *influxdbCollector) newEndpoint(scheme string, address string) (*endpoint, error) {
 	errs := []error{}
 	var err error
 	queryStatementStats := "show stats"
 	queryStatementDiagn := "show diagnostics"
+	ep := &endpoint{instance: address}
 
-	if ic.urlStatistic, err = createURL(host, port, user, passwd, queryStatementStats); err != nil {
+	if ep.urlStatistic, err = createURL(scheme, address, ic.auth, queryStatementStats); err != nil {
 		errs = append(errs, err)
 
 		log.WithFields(log.Fields{
 			"block":    "monitor",
-			"function": "InitURLs",
+			"function": "newEndpoint",
+			"instance": address,
 			"err":      err,
 		}).Errorf("Cannot parse raw url into a URL structure with query `%s`", queryStatementStats)
 	}
 
-	if ic.urlDiagnostic, err = createURL(host, port, user, passwd, queryStatementDiagn); err != nil {
+	if ep.urlDiagnostic, err = createURL(scheme, address, ic.auth, queryStatementDiagn); err != nil {
 		errs = append(errs, err)
 
 		log.WithFields(log.Fields{
 			"block":    "monitor",
-			"function": "InitURLs",
+			"function": "newEndpoint",
+			"instance": address,
 			"err":      err,
 		}).Errorf("Cannot parse raw url into a URL structure with query `%s`", queryStatementDiagn)
 	}
 
+	if ep.urlPing, err = pingURL(scheme, address); err != nil {
+		errs = append(errs, err)
+
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "newEndpoint",
+			"instance": address,
+			"err":      err,
+		}).Error("Cannot parse raw url of ping into a URL structure")
+	}
+
+	if ep.urlDebugVars, err = debugVarsURL(scheme, address); err != nil {
+		errs = append(errs, err)
+
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "newEndpoint",
+			"instance": address,
+			"err":      err,
+		}).Error("Cannot parse raw url of debug vars into a URL structure")
+	}
+
+	if ep.urlMetrics, err = metricsURL(scheme, address); err != nil {
+		errs = append(errs, err)
+
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "newEndpoint",
+			"instance": address,
+			"err":      err,
+		}).Error("Cannot parse raw url of metrics into a URL structure")
+	}
+
 	if len(errs) != 0 {
-		return errors.New("Cannot initialize URLs, invalid URL-encoding")
+		return nil, fmt.Errorf("Cannot initialize URLs of %s, invalid URL-encoding", address)
 	}
 
-	return nil
+	return ep, nil
 }
 
 // --------- helper functions -------------- //
 
-func getHttpResponse(url string) ([]byte, error) {
-	response, err := http.Get(url)
+// getTLSOptions returns TLS settings based on plugin config `cfg`
+func getTLSOptions(cfg plugin.Config) (tlsOptions, error) {
+	var opts tlsOptions
+	var err error
+
+	if opts.caFile, err = getConfigString(cfg, "ca_file", ""); err != nil {
+		return opts, fmt.Errorf("Cannot get a CA file from plugin config, err=%s", err.Error())
+	}
+	if opts.certFile, err = getConfigString(cfg, "cert_file", ""); err != nil {
+		return opts, fmt.Errorf("Cannot get a cert file from plugin config, err=%s", err.Error())
+	}
+	if opts.keyFile, err = getConfigString(cfg, "key_file", ""); err != nil {
+		return opts, fmt.Errorf("Cannot get a key file from plugin config, err=%s", err.Error())
+	}
+	if opts.serverName, err = getConfigString(cfg, "server_name", ""); err != nil {
+		return opts, fmt.Errorf("Cannot get a server name from plugin config, err=%s", err.Error())
+	}
+	if opts.insecureSkipVerify, err = getConfigBool(cfg, "insecure_skip_verify", false); err != nil {
+		return opts, fmt.Errorf("Cannot get insecure_skip_verify from plugin config, err=%s", err.Error())
+	}
+
+	return opts, nil
+}
+
+// getStatsFilter returns filter of statistics based on plugin config `cfg`
+func getStatsFilter(cfg plugin.Config) (statsFilter, error) {
+	var f statsFilter
+	var err error
+
+	if f.modules, err = getPatternFilter(cfg, "modules"); err != nil {
+		return f, err
+	}
+	if f.columns, err = getPatternFilter(cfg, "columns"); err != nil {
+		return f, err
+	}
+	f.tags = map[string]patternFilter{}
+	for tag, name := range filteredTags {
+		if f.tags[tag], err = getPatternFilter(cfg, name); err != nil {
+			return f, err
+		}
+	}
+
+	return f, nil
+}
 
+// getPatternFilter returns filter given by config items `include_<name>` and `exclude_<name>`
+func getPatternFilter(cfg plugin.Config, name string) (patternFilter, error) {
+	include, err := getConfigString(cfg, "include_"+name, "")
 	if err != nil {
-		return nil, err
+		return patternFilter{}, fmt.Errorf("Cannot get include_%s from plugin config, err=%s", name, err.Error())
+	}
+	exclude, err := getConfigString(cfg, "exclude_"+name, "")
+	if err != nil {
+		return patternFilter{}, fmt.Errorf("Cannot get exclude_%s from plugin config, err=%s", name, err.Error())
 	}
-	defer response.Body.Close()
+	f, err := newPatternFilter(include, exclude)
+	if err != nil {
+		return f, fmt.Errorf("Invalid filter of %s, err=%s", name, err.Error())
+	}
+	return f, nil
+}
 
-	return ioutil.ReadAll(response.Body)
+// getConfigString returns string value of optional config item `key`, or `def` when the item is not set
+func getConfigString(cfg plugin.Config, key string, def string) (string, error) {
+	if _, ok := cfg[key]; !ok {
+		return def, nil
+	}
+	return cfg.GetString(key)
+}
+
+// getConfigInt returns integer value of optional config item `key`, or `def` when the item is not set
+func getConfigInt(cfg plugin.Config, key string, def int64) (int64, error) {
+	if _, ok := cfg[key]; !ok {
+		return def, nil
+	}
+	return cfg.GetInt(key)
+}
+
+// getConfigDuration returns duration parsed from optional config item `key`, or `def` when the item is not set
+func getConfigDuration(cfg plugin.Config, key string, def time.Duration) (time.Duration, error) {
+	if _, ok := cfg[key]; !ok {
+		return def, nil
+	}
+	value, err := cfg.GetString(key)
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration %s must not be negative", value)
+	}
+	return d, nil
+}
+
+// getConfigBool returns boolean value of optional config item `key`, or `def` when the item is not set
+func getConfigBool(cfg plugin.Config, key string, def bool) (bool, error) {
+	if _, ok := cfg[key]; !ok {
+		return def, nil
+	}
+	return cfg.GetBool(key)
 }
 
-// createURL returns URL structure created base on hostname, port, credentials and query statement
-func createURL(host string, port int64, user string, passwd string, query string) (*url.URL, error) {
-	u, err := url.Parse(fmt.Sprintf("http://%s:%d/query?u=%s&p=%s&pretty=true",
-		host,
-		port,
-		user,
-		passwd,
+// createURL returns URL structure created base on scheme, address (host:port), credentials and query statement
+func createURL(scheme string, address string, auth authOptions, query string) (*url.URL, error) {
+	u, err := url.Parse(fmt.Sprintf("%s://%s/query?pretty=true",
+		scheme,
+		address,
 	))
 
 	if err != nil {
@@ -291,6 +924,7 @@ func createURL(host string, port int64, user string, passwd string, query string
 
 	q := u.Query()
 	q.Set("q", query)
+	auth.setQuery(q)
 	u.RawQuery = q.Encode()
 
 	return u, nil
@@ -17,45 +17,61 @@ limitations under the License.
 package influxdb
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
 
 	"strings"
+	"sync"
+	"time"
 
 	"net/url"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
 
-func getMockHTTPResponse(url string) ([]byte, error) {
-	if strings.Contains(url, "stats") {
+func getMockHTTPResponse(ctx context.Context, url string) ([]byte, error) {
+	path := strings.SplitN(url, "?", 2)[0]
+	if strings.Contains(path, "stats") {
 		return []byte(mockStatResults), nil
-	} else if strings.Contains(url, "diagnostics") {
+	} else if strings.Contains(path, "diagnostics") {
 		return []byte(mockDiagnosticResults), nil
 	}
 	return nil, errors.New("invalid arg")
 }
 
-func getEmptyMockHTTPResponse(url string) ([]byte, error) {
-	if strings.Contains(url, "stats") {
+func getEmptyMockHTTPResponse(ctx context.Context, url string) ([]byte, error) {
+	path := strings.SplitN(url, "?", 2)[0]
+	if strings.Contains(path, "stats") {
 		return []byte("{}"), nil
-	} else if strings.Contains(url, "diagnostics") {
+	} else if strings.Contains(path, "diagnostics") {
 		return []byte("{}"), nil
 	}
 	return nil, errors.New("invalid arg")
 }
 
+// mockShardNamespace returns namespace of shard statistic `column` with dynamic elements
+func mockShardNamespace(column string) plugin.Namespace {
+	return plugin.NewNamespace("intel", "influxdb", "stat", "shard").
+		AddDynamicElement("engine", "storage engine of the shard").
+		AddDynamicElement("database", "name of database").
+		AddDynamicElement("retention_policy", "name of retention policy").
+		AddDynamicElement("shard_id", "identifier of the shard").
+		AddStaticElement(column)
+}
+
 var mockMtsStat = []plugin.Metric{
 	plugin.Metric{
-		Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "shard", "diskBytes"),
+		Namespace: mockShardNamespace("diskBytes"),
 		Tags:      map[string]string{},
 	},
-	plugin.Metric{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "shard", "fieldsCreate"),
+	plugin.Metric{Namespace: mockShardNamespace("fieldsCreate"),
 		Tags: map[string]string{},
 	},
-	plugin.Metric{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "shard", "seriesCreate"),
+	plugin.Metric{Namespace: mockShardNamespace("seriesCreate"),
 		Tags: map[string]string{},
 	},
 	plugin.Metric{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "queryReq"),
@@ -145,9 +161,8 @@ func TestGetMetricTypes(t *testing.T) {
 	Convey("Metrics are not available", t, func() {
 		Convey("when cannot obtain any data", func() {
 			influxdbPlugin := &influxdbCollector{
-				getResponse:   getMockHTTPResponse,
-				urlDiagnostic: &url.URL{Path: ""},
-				urlStatistic:  &url.URL{Path: ""},
+				getResponse: getMockHTTPResponse,
+				endpoints:   []*endpoint{newMockEndpoint("", "")},
 			}
 			cfg := getMockConfig()
 
@@ -159,9 +174,8 @@ func TestGetMetricTypes(t *testing.T) {
 	})
 	Convey("Successfully get metrics types", t, func() {
 		influxdbPlugin := &influxdbCollector{
-			getResponse:   getMockHTTPResponse,
-			urlDiagnostic: &url.URL{Path: "diagnostics"},
-			urlStatistic:  &url.URL{Path: "stats"},
+			getResponse: getMockHTTPResponse,
+			endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
 		}
 		cfg := getMockConfig()
 
@@ -176,9 +190,8 @@ func TestCollectMetrics(t *testing.T) {
 
 	Convey("Initialization fails", t, func() {
 		influxdbPlugin := &influxdbCollector{
-			getResponse:   getMockHTTPResponse,
-			urlDiagnostic: &url.URL{Path: ""},
-			urlStatistic:  &url.URL{Path: ""},
+			getResponse: getMockHTTPResponse,
+			endpoints:   []*endpoint{newMockEndpoint("", "")},
 		}
 
 		So(func() { influxdbPlugin.CollectMetrics(mockMts) }, ShouldNotPanic)
@@ -189,9 +202,8 @@ func TestCollectMetrics(t *testing.T) {
 
 	Convey("Metrics are not available", t, func() {
 		influxdbPlugin := &influxdbCollector{
-			getResponse:   getEmptyMockHTTPResponse,
-			urlDiagnostic: &url.URL{Path: "diagnostics"},
-			urlStatistic:  &url.URL{Path: "stats"},
+			getResponse: getEmptyMockHTTPResponse,
+			endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
 		}
 
 		Convey("when cannot get  data", func() {
@@ -202,9 +214,8 @@ func TestCollectMetrics(t *testing.T) {
 	})
 	Convey("Successful collecting metrics", t, func() {
 		influxdbPlugin := &influxdbCollector{
-			getResponse:   getMockHTTPResponse,
-			urlDiagnostic: &url.URL{Path: "diagnostics"},
-			urlStatistic:  &url.URL{Path: "stats"},
+			getResponse: getMockHTTPResponse,
+			endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
 		}
 
 		results, err := influxdbPlugin.CollectMetrics(mockMts)
@@ -219,6 +230,500 @@ func TestCollectMetrics(t *testing.T) {
 		}
 		So(len(results), ShouldBeGreaterThanOrEqualTo, len(mockMts))
 	})
+	Convey("Successful collecting metrics from multiple instances", t, func() {
+		first := newMockEndpoint("stats", "diagnostics")
+		second := newMockEndpoint("stats", "diagnostics")
+		second.instance = "otherhost:8086"
+		influxdbPlugin := &influxdbCollector{
+			getResponse: getMockHTTPResponse,
+			endpoints:   []*endpoint{first, second},
+		}
+
+		results, err := influxdbPlugin.CollectMetrics(mockMtsDiagn)
+		So(err, ShouldBeNil)
+		So(len(results), ShouldEqual, 2*len(mockMtsDiagn))
+
+		instances := map[string]int{}
+		for _, metric := range results {
+			instances[metric.Tags[tagInstance]]++
+		}
+		So(instances[first.instance], ShouldEqual, len(mockMtsDiagn))
+		So(instances[second.instance], ShouldEqual, len(mockMtsDiagn))
+
+		Convey("and metric types are not duplicated", func() {
+			mts, err := influxdbPlugin.GetMetricTypes(getMockConfig())
+			So(err, ShouldBeNil)
+			known := map[string]bool{}
+			for _, mt := range mts {
+				So(known[mt.Namespace.String()], ShouldBeFalse)
+				known[mt.Namespace.String()] = true
+			}
+		})
+	})
+}
+
+func TestDynamicMetrics(t *testing.T) {
+	influxdbPlugin := &influxdbCollector{
+		getResponse: getMockHTTPResponse,
+		endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
+	}
+
+	Convey("Metric types of shards are exposed with dynamic elements", t, func() {
+		mts, err := influxdbPlugin.GetMetricTypes(getMockConfig())
+		So(err, ShouldBeNil)
+
+		namespaces := map[string]plugin.Namespace{}
+		for _, mt := range mts {
+			namespaces[mt.Namespace.String()] = mt.Namespace
+		}
+		So(namespaces, ShouldContainKey, "/intel/influxdb/stat/shard/*/*/*/*/writePointsOk")
+		So(namespaces, ShouldContainKey, "/intel/influxdb/stat/tsm1_wal/*/*/*/*/writeOk")
+		So(namespaces, ShouldContainKey, "/intel/influxdb/stat/database/*/numSeries")
+		So(namespaces, ShouldContainKey, "/intel/influxdb/stat/httpd/queryReq")
+
+		isDynamic, indexes := namespaces["/intel/influxdb/stat/shard/*/*/*/*/writePointsOk"].IsDynamic()
+		So(isDynamic, ShouldBeTrue)
+		So(indexes, ShouldResemble, []int{4, 5, 6, 7})
+	})
+
+	Convey("Collecting metrics of shards", t, func() {
+		Convey("returns metric for each shard", func() {
+			results, err := influxdbPlugin.CollectMetrics([]plugin.Metric{
+				{Namespace: mockShardNamespace("writePointsOk")},
+			})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 2)
+
+			values := map[string]interface{}{}
+			for _, mt := range results {
+				values[mt.Namespace.String()] = mt.Data
+				So(mt.Namespace[5].Name, ShouldEqual, "database")
+			}
+			So(values["/intel/influxdb/stat/shard/tsm1/snap/autogen/1/writePointsOk"], ShouldEqual, int64(3397))
+			So(values["/intel/influxdb/stat/shard/tsm1/_internal/monitor/2/writePointsOk"], ShouldEqual, int64(714))
+		})
+		Convey("returns only metrics of selected database", func() {
+			ns := mockShardNamespace("writePointsOk")
+			ns[5].Value = "snap"
+			results, err := influxdbPlugin.CollectMetrics([]plugin.Metric{{Namespace: ns}})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Namespace.Strings(), ShouldResemble,
+				[]string{"intel", "influxdb", "stat", "shard", "tsm1", "snap", "autogen", "1", "writePointsOk"})
+			So(results[0].Tags["database"], ShouldEqual, "snap")
+		})
+	})
+}
+
+func TestPartialResults(t *testing.T) {
+	Convey("Collecting metrics when some of queries fail", t, func() {
+		broken := newMockEndpoint("stats", "")
+		broken.instance = "broken:8086"
+		influxdbPlugin := &influxdbCollector{
+			getResponse: getMockHTTPResponse,
+			endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics"), broken},
+		}
+		nsErrors := plugin.NewNamespace("intel", "influxdb", "collector", "errors")
+
+		results, err := influxdbPlugin.CollectMetrics(append([]plugin.Metric{{Namespace: nsErrors}}, mockMts...))
+		So(err, ShouldBeNil)
+
+		instances := map[string]int{}
+		failures := map[string]interface{}{}
+		for _, mt := range results {
+			if mt.Namespace.String() == nsErrors.String() {
+				failures[mt.Tags[tagInstance]] = mt.Data
+				continue
+			}
+			instances[mt.Tags[tagInstance]]++
+		}
+		So(failures, ShouldResemble, map[string]interface{}{"hostname:1234": int64(0), "broken:8086": int64(1)})
+		So(instances["hostname:1234"], ShouldBeGreaterThanOrEqualTo, len(mockMts))
+		So(instances["broken:8086"], ShouldBeGreaterThanOrEqualTo, len(mockMtsStat))
+	})
+}
+
+func TestDiagnosticsCache(t *testing.T) {
+	Convey("Collecting diagnostics", t, func() {
+		var mutex sync.Mutex
+		queries := map[string]int{}
+		totalAlloc := 43560664
+		getCountingMockHTTPResponse := func(ctx context.Context, url string) ([]byte, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			path := strings.SplitN(url, "?", 2)[0]
+			queries[path]++
+			if path == "stats" {
+				return []byte(fmt.Sprintf(`{"results":[{"series":[{"name":"runtime","columns":["TotalAlloc"],"values":[[%d]]}]}]}`, totalAlloc)), nil
+			}
+			return getMockHTTPResponse(ctx, url)
+		}
+		influxdbPlugin := &influxdbCollector{
+			getResponse:    getCountingMockHTTPResponse,
+			endpoints:      []*endpoint{newMockEndpoint("stats", "diagnostics")},
+			diagnosticsTTL: time.Hour,
+		}
+
+		Convey("queries diagnostics only when they are requested", func() {
+			_, err := influxdbPlugin.CollectMetrics(mockMtsStat)
+			So(err, ShouldBeNil)
+			So(queries["stats"], ShouldEqual, 1)
+			So(queries["diagnostics"], ShouldEqual, 0)
+		})
+		Convey("queries diagnostics once during TTL", func() {
+			for i := 0; i < 3; i++ {
+				results, err := influxdbPlugin.CollectMetrics(mockMtsDiagn)
+				So(err, ShouldBeNil)
+				So(len(results), ShouldEqual, len(mockMtsDiagn))
+			}
+			So(queries["diagnostics"], ShouldEqual, 1)
+
+			Convey("and again when they expire", func() {
+				influxdbPlugin.diagnosticsTTL = time.Nanosecond
+				_, err := influxdbPlugin.CollectMetrics(mockMtsDiagn)
+				So(err, ShouldBeNil)
+				So(queries["diagnostics"], ShouldEqual, 2)
+			})
+			Convey("and again when InfluxDB restarts while only diagnostics are requested", func() {
+				totalAlloc = 1024
+				results, err := influxdbPlugin.CollectMetrics(mockMtsDiagn)
+				So(err, ShouldBeNil)
+				So(len(results), ShouldEqual, len(mockMtsDiagn))
+				_, err = influxdbPlugin.CollectMetrics(mockMtsDiagn)
+				So(err, ShouldBeNil)
+				So(queries["diagnostics"], ShouldEqual, 2)
+				So(influxdbPlugin.endpoints[0].diagnostics.restarts, ShouldEqual, 1)
+			})
+			Convey("and again when InfluxDB restarts", func() {
+				// restarts are detected from runtime statistics, which are queried along with diagnostics
+				mts := append([]plugin.Metric{
+					{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "runtime", "TotalAlloc")},
+				}, mockMtsDiagn...)
+				_, err := influxdbPlugin.CollectMetrics(mts)
+				So(err, ShouldBeNil)
+				totalAlloc = 1024
+				_, err = influxdbPlugin.CollectMetrics(mts)
+				So(err, ShouldBeNil)
+				_, err = influxdbPlugin.CollectMetrics(mts)
+				So(err, ShouldBeNil)
+				So(queries["diagnostics"], ShouldEqual, 2)
+			})
+		})
+		Convey("queries diagnostics each time when caching is disabled", func() {
+			influxdbPlugin.diagnosticsTTL = 0
+			for i := 0; i < 3; i++ {
+				_, err := influxdbPlugin.CollectMetrics(mockMtsDiagn)
+				So(err, ShouldBeNil)
+			}
+			So(queries["diagnostics"], ShouldEqual, 3)
+		})
+	})
+
+	Convey("Caching diagnostics detects restart of InfluxDB process", t, func() {
+		cache := &diagnosticsCache{}
+		mts := []plugin.Metric{
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "diagn", "system", "PID"), Data: int64(1)},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "diagn", "system", "started"), Data: "2017-01-21T00:32:06.589263607Z"},
+		}
+		So(cache.set(mts), ShouldBeFalse)
+		So(cache.set(mts), ShouldBeFalse)
+
+		restarted := []plugin.Metric{mts[0], {Namespace: mts[1].Namespace, Data: "2017-01-22T00:00:00Z"}}
+		So(cache.set(restarted), ShouldBeTrue)
+		restarts, reset := cache.reportRestarts()
+		So(restarts, ShouldEqual, 1)
+		So(reset, ShouldBeTrue)
+
+		Convey("and counts restart detected from statistics once", func() {
+			So(cache.observeTotalAlloc(2048), ShouldBeFalse)
+			So(cache.observeTotalAlloc(1024), ShouldBeTrue)
+			So(cache.resetDetected(), ShouldBeTrue)
+			So(cache.set(mts), ShouldBeFalse)
+			So(cache.observeTotalAlloc(4096), ShouldBeFalse)
+			restarts, reset := cache.reportRestarts()
+			So(restarts, ShouldEqual, 2)
+			So(reset, ShouldBeTrue)
+			restarts, reset = cache.reportRestarts()
+			So(restarts, ShouldEqual, 2)
+			So(reset, ShouldBeFalse)
+			So(cache.resetDetected(), ShouldBeFalse)
+		})
+	})
+}
+
+func TestRestarts(t *testing.T) {
+	Convey("Collecting metrics of InfluxDB restarts", t, func() {
+		var mutex sync.Mutex
+		pid, totalAlloc, req := 100, 43560664, 1000
+		getRestartingMockHTTPResponse := func(ctx context.Context, url string) ([]byte, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if strings.HasPrefix(url, "diagnostics") {
+				return []byte(fmt.Sprintf(`{"results":[{"series":[{"name":"system","columns":["PID","started"],"values":[[%d,"2017-01-21T00:32:06Z"]]}]}]}`, pid)), nil
+			}
+			return []byte(fmt.Sprintf(`{"results":[{"series":[{"name":"runtime","columns":["TotalAlloc"],"values":[[%d]]},{"name":"httpd","columns":["req"],"values":[[%d]]}]}]}`, totalAlloc, req)), nil
+		}
+		restart := func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+			pid, totalAlloc, req = pid+1, 1024, 10
+		}
+		influxdbPlugin := &influxdbCollector{
+			getResponse:    getRestartingMockHTTPResponse,
+			endpoints:      []*endpoint{newMockEndpoint("stats", "diagnostics")},
+			diagnosticsTTL: time.Hour,
+		}
+		mts := []plugin.Metric{
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "collector", "restarts")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "collector", "counter_reset")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "req", "delta")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "diagn", "system", "PID")},
+		}
+		collect := func() map[string]interface{} {
+			results, err := influxdbPlugin.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			values := map[string]interface{}{}
+			for _, mt := range results {
+				values[mt.Namespace.String()] = mt.Data
+			}
+			return values
+		}
+
+		values := collect()
+		So(values["/intel/influxdb/collector/restarts"], ShouldEqual, int64(0))
+		So(values["/intel/influxdb/collector/counter_reset"], ShouldEqual, false)
+		values = collect()
+		So(values["/intel/influxdb/stat/httpd/req/delta"], ShouldEqual, int64(0))
+
+		restart()
+		values = collect()
+		So(values["/intel/influxdb/collector/restarts"], ShouldEqual, int64(1))
+		So(values["/intel/influxdb/collector/counter_reset"], ShouldEqual, true)
+		So(values, ShouldNotContainKey, "/intel/influxdb/stat/httpd/req/delta")
+
+		values = collect()
+		So(values["/intel/influxdb/collector/restarts"], ShouldEqual, int64(1))
+		So(values["/intel/influxdb/collector/counter_reset"], ShouldEqual, false)
+		So(values["/intel/influxdb/diagn/system/PID"], ShouldEqual, int64(101))
+		So(values["/intel/influxdb/stat/httpd/req/delta"], ShouldEqual, int64(0))
+	})
+}
+
+func TestQueryPlan(t *testing.T) {
+	Convey("Planning queries", t, func() {
+		Convey("queries everything for wildcard", func() {
+			plan := newQueryPlan([]plugin.Metric{{Namespace: plugin.NewNamespace("intel", "influxdb", "*")}}, true)
+			So(plan, ShouldResemble, fullPlan)
+		})
+		Convey("queries only statistics of requested modules", func() {
+			plan := newQueryPlan(mockMtsStat, true)
+			So(plan.diagnostics, ShouldBeFalse)
+			So(plan.statistics, ShouldBeTrue)
+			So(plan.modules, ShouldResemble, []string{"httpd", "shard"})
+			So(plan.derived, ShouldBeFalse)
+		})
+		Convey("derives counters only when their rates or deltas are requested", func() {
+			plan := newQueryPlan([]plugin.Metric{{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "req", "rate")}}, true)
+			So(plan.derived, ShouldBeTrue)
+			So(plan.modules, ShouldResemble, []string{"httpd", "runtime"})
+		})
+		Convey("queries runtime statistics together with diagnostics", func() {
+			plan := newQueryPlan(mockMts, true)
+			So(plan.diagnostics, ShouldBeTrue)
+			So(plan.modules, ShouldResemble, []string{"httpd", "runtime", "shard"})
+		})
+		Convey("queries all statistics when module is not selected", func() {
+			plan := newQueryPlan(append([]plugin.Metric{{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "*", "req")}}, mockMtsStat...), true)
+			So(plan.statistics, ShouldBeTrue)
+			So(plan.modules, ShouldBeEmpty)
+		})
+		Convey("queries only diagnostics", func() {
+			plan := newQueryPlan(mockMtsDiagn, false)
+			So(plan.diagnostics, ShouldBeTrue)
+			So(plan.statistics, ShouldBeFalse)
+		})
+		Convey("queries runtime statistics together with cached diagnostics", func() {
+			plan := newQueryPlan(mockMtsDiagn, true)
+			So(plan.diagnostics, ShouldBeTrue)
+			So(plan.statistics, ShouldBeTrue)
+			So(plan.modules, ShouldResemble, []string{"runtime"})
+		})
+		Convey("queries statistics when only metrics of collector are requested", func() {
+			plan := newQueryPlan([]plugin.Metric{{Namespace: plugin.NewNamespace("intel", "influxdb", "collector", "errors")}}, true)
+			So(plan.statistics, ShouldBeTrue)
+			So(plan.modules, ShouldResemble, []string{"runtime"})
+		})
+	})
+
+	Convey("Querying statistics of selected modules", t, func() {
+		var mutex sync.Mutex
+		urls := []string{}
+		supported := true
+		influxdbPlugin := &influxdbCollector{
+			getResponse: func(ctx context.Context, u string) ([]byte, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				urls = append(urls, u)
+				if strings.Contains(u, "for") && !supported {
+					return []byte(`{"error":"error parsing query: found FOR, expected ;"}`), nil
+				}
+				return getMockHTTPResponse(ctx, u)
+			},
+			endpoints: []*endpoint{newMockEndpoint("stats", "diagnostics")},
+		}
+		influxdbPlugin.endpoints[0].urlStatistic = &url.URL{Path: "stats", RawQuery: "q=show+stats"}
+
+		Convey("uses module-scoped statements", func() {
+			results, err := influxdbPlugin.CollectMetrics(mockMtsStat)
+			So(err, ShouldBeNil)
+			So(results, ShouldNotBeEmpty)
+			So(len(urls), ShouldEqual, 1)
+			q, _ := url.ParseQuery(strings.SplitN(urls[0], "?", 2)[1])
+			So(q.Get("q"), ShouldEqual, "show stats for 'httpd'; show stats for 'shard'")
+		})
+		Convey("falls back to all statistics when InfluxDB does not support it", func() {
+			supported = false
+			for i := 0; i < 2; i++ {
+				results, err := influxdbPlugin.CollectMetrics(mockMtsStat)
+				So(err, ShouldBeNil)
+				So(results, ShouldNotBeEmpty)
+			}
+			So(len(urls), ShouldEqual, 3)
+			So(urls[2], ShouldEqual, "stats?q=show+stats")
+		})
+	})
+}
+
+func TestTypedValues(t *testing.T) {
+	Convey("Decoding values of statistics", t, func() {
+		var values []interface{}
+		err := decodeResponse([]byte(`[1, -2, 18446744073709551615, 1.5, 1.2e+21, "1.1.1", true, null]`), &values)
+		So(err, ShouldBeNil)
+
+		typed := []interface{}{}
+		for _, v := range values {
+			typed = append(typed, typedValue(v))
+		}
+		So(typed, ShouldResemble, []interface{}{
+			int64(1), int64(-2), uint64(18446744073709551615), 1.5, 1.2e+21, "1.1.1", true, nil,
+		})
+	})
+
+	Convey("Collecting statistics of different types", t, func() {
+		influxdbPlugin := &influxdbCollector{
+			getResponse: func(ctx context.Context, url string) ([]byte, error) {
+				return []byte(`{"results":[{"series":[{"name":"runtime","columns":["Alloc","GCCPUFraction","Version","Enabled","Missing"],"values":[[18243880,0.0012,"1.3.0",true,null]]}]}]}`), nil
+			},
+			endpoints: []*endpoint{newMockEndpoint("stats", "diagnostics")},
+		}
+
+		results, err := influxdbPlugin.CollectMetrics([]plugin.Metric{
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "runtime", "*")},
+		})
+		So(err, ShouldBeNil)
+
+		values := map[string]interface{}{}
+		for _, mt := range results {
+			values[mt.Namespace.Strings()[4]] = mt.Data
+		}
+		So(values, ShouldResemble, map[string]interface{}{
+			"Alloc":         int64(18243880),
+			"GCCPUFraction": 0.0012,
+			"Version":       "1.3.0",
+			"Enabled":       true,
+		})
+	})
+}
+
+func TestGetMetricsConcurrently(t *testing.T) {
+	Convey("Getting metrics from many instances", t, func() {
+		var mutex sync.Mutex
+		active, maxActive := 0, 0
+		getSlowMockHTTPResponse := func(ctx context.Context, url string) ([]byte, error) {
+			mutex.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mutex.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mutex.Lock()
+			active--
+			mutex.Unlock()
+			return getMockHTTPResponse(ctx, url)
+		}
+
+		endpoints := []*endpoint{}
+		for i := 0; i < 5; i++ {
+			endpoints = append(endpoints, newMockEndpoint("stats", "diagnostics"))
+		}
+
+		Convey("runs at most max_concurrency queries at the same time", func() {
+			influxdbPlugin := &influxdbCollector{
+				getResponse:    getSlowMockHTTPResponse,
+				endpoints:      endpoints,
+				maxConcurrency: 3,
+			}
+			mts, err := influxdbPlugin.getMetrics(fullPlan)
+			So(err, ShouldBeNil)
+			So(mts, ShouldNotBeEmpty)
+			So(maxActive, ShouldBeGreaterThan, 1)
+			So(maxActive, ShouldBeLessThanOrEqualTo, 3)
+		})
+		Convey("stops waiting for instances which do not respond before deadline", func() {
+			influxdbPlugin := &influxdbCollector{
+				getResponse: func(ctx context.Context, url string) ([]byte, error) {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				},
+				endpoints:      endpoints,
+				maxConcurrency: 1,
+				collectTimeout: 20 * time.Millisecond,
+			}
+			start := time.Now()
+			_, err := influxdbPlugin.getMetrics(fullPlan)
+			So(err, ShouldNotBeNil)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+	})
+}
+
+func TestParseHosts(t *testing.T) {
+	Convey("Parsing list of hosts", t, func() {
+		Convey("returns host and port when list is empty", func() {
+			addresses, err := parseHosts(" ", "localhost", 8086)
+			So(err, ShouldBeNil)
+			So(addresses, ShouldResemble, []string{"localhost:8086"})
+		})
+		Convey("uses default port for items without port", func() {
+			addresses, err := parseHosts("a:8087, b,a:8087,[::1]:8088,::1", "localhost", 8086)
+			So(err, ShouldBeNil)
+			So(addresses, ShouldResemble, []string{"a:8087", "b:8086", "[::1]:8088", "[::1]:8086"})
+		})
+		Convey("fails for invalid port", func() {
+			_, err := parseHosts("a:http", "localhost", 8086)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("fails for empty hostname", func() {
+			_, err := parseHosts(":8086", "localhost", 8086)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("fails when list has no items", func() {
+			_, err := parseHosts(",,", "localhost", 8086)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func newMockEndpoint(pathStatistic string, pathDiagnostic string) *endpoint {
+	return &endpoint{
+		instance:      "hostname:1234",
+		urlStatistic:  &url.URL{Path: pathStatistic},
+		urlDiagnostic: &url.URL{Path: pathDiagnostic},
+		urlPing:       &url.URL{Path: "ping"},
+	}
 }
 
 func getMockConfig() plugin.Config {
@@ -230,3 +735,134 @@ func getMockConfig() plugin.Config {
 		"password": "passwd",
 	}
 }
+
+func TestSystemTimeDiagnostics(t *testing.T) {
+	Convey("Collecting diagnostics of system time", t, func() {
+		influxdbPlugin := &influxdbCollector{
+			getResponse:    getMockHTTPResponse,
+			endpoints:      []*endpoint{newMockEndpoint("stats", "diagnostics")},
+			diagnosticsTTL: time.Hour,
+		}
+		mts := []plugin.Metric{
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "diagn", "system", "uptime_seconds")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "diagn", "system", "started_unix")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "diagn", "system", "clock_skew_seconds")},
+		}
+		collect := func() map[string]interface{} {
+			results, err := influxdbPlugin.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, len(mts))
+			values := map[string]interface{}{}
+			for _, mt := range results {
+				So(mt.Tags[tagInstance], ShouldEqual, "hostname:1234")
+				values[mt.Namespace.Strings()[4]] = mt.Data
+			}
+			return values
+		}
+
+		values := collect()
+		So(values["started_unix"], ShouldEqual, int64(1484958726))
+		// mocked diagnostics come from the past, so the clock of InfluxDB is behind
+		So(values["clock_skew_seconds"], ShouldBeLessThan, 0)
+		// uptime is measured by the clock of InfluxDB
+		So(values["uptime_seconds"], ShouldAlmostEqual, 1871.8, 1)
+
+		Convey("and keeps uptime up to date while diagnostics are cached", func() {
+			time.Sleep(10 * time.Millisecond)
+			So(collect()["uptime_seconds"], ShouldBeGreaterThan, values["uptime_seconds"])
+		})
+	})
+
+	Convey("Computing uptime without start time of InfluxDB", t, func() {
+		mts := []plugin.Metric{{Namespace: plugin.NewNamespace("intel", "influxdb", "diagn", "system", "uptime"), Data: "2h3m4.5s"}}
+		now := time.Now()
+		res := withUptime(mts, "hostname:1234", now, now)
+		So(len(res), ShouldEqual, 2)
+		So(res[1].Data, ShouldEqual, 7384.5)
+		So(len(mts), ShouldEqual, 1)
+
+		Convey("keeps uptime up to date while diagnostics are cached", func() {
+			res := withUptime(mts, "hostname:1234", now, now.Add(10*time.Second))
+			So(res[1].Data, ShouldEqual, 7394.5)
+		})
+	})
+}
+
+func TestNormalizeNames(t *testing.T) {
+	Convey("Normalising names of statistics", t, func() {
+		So(canonicalStatistic("httpd", "write_req"), ShouldEqual, "writeReq")
+		So(canonicalStatistic("httpd", "points_written_ok"), ShouldEqual, "pointsWrittenOK")
+		So(canonicalStatistic("engine", "blks_write_bytes_c"), ShouldEqual, "blksWriteBytesC")
+		So(canonicalStatistic("write", "req"), ShouldEqual, "req")
+		So(canonicalStatistic("runtime", "HeapAlloc"), ShouldEqual, "HeapAlloc")
+	})
+
+	Convey("Recognizing releases reporting legacy names", t, func() {
+		legacy, err := isLegacyVersion("0.9.6")
+		So(err, ShouldBeNil)
+		So(legacy, ShouldBeTrue)
+		legacy, err = isLegacyVersion("v1.1.1")
+		So(err, ShouldBeNil)
+		So(legacy, ShouldBeFalse)
+		_, err = isLegacyVersion("unknown")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Collecting statistics of InfluxDB", t, func() {
+		var mutex sync.Mutex
+		version := "0.9.6"
+		queries := 0
+		getVersionedMockHTTPResponse := func(ctx context.Context, url string) ([]byte, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if strings.HasPrefix(url, "diagnostics") {
+				queries++
+				return []byte(fmt.Sprintf(`{"results":[{"series":[{"name":"build","columns":["Version"],"values":[["%s"]]}]}]}`, version)), nil
+			}
+			return []byte(`{"results":[{"series":[{"name":"httpd","columns":["write_req","points_written_ok","req"],"values":[[1,2,3]]}]}]}`), nil
+		}
+		influxdbPlugin := &influxdbCollector{
+			getResponse:    getVersionedMockHTTPResponse,
+			endpoints:      []*endpoint{newMockEndpoint("stats", "diagnostics")},
+			diagnosticsTTL: time.Hour,
+			normalizeNames: true,
+		}
+		mts := []plugin.Metric{{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "*")}}
+		collect := func() []string {
+			results, err := influxdbPlugin.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			names := []string{}
+			for _, mt := range results {
+				names = append(names, mt.Namespace.Strings()[4])
+			}
+			return names
+		}
+
+		Convey("maps names to canonical ones without querying diagnostics when version is not known", func() {
+			So(collect(), ShouldResemble, []string{"writeReq", "pointsWrittenOK", "req"})
+			collect()
+			So(queries, ShouldEqual, 0)
+		})
+		Convey("maps names of releases older than 1.0 to canonical ones", func() {
+			influxdbPlugin.endpoints[0].scrapes.recordPing(pingResult{reachable: true, version: "0.9.6"})
+			So(collect(), ShouldResemble, []string{"writeReq", "pointsWrittenOK", "req"})
+		})
+		Convey("keeps names of newer releases reported by ping", func() {
+			influxdbPlugin.endpoints[0].scrapes.recordPing(pingResult{reachable: true, version: "1.1.1"})
+			So(collect(), ShouldResemble, []string{"write_req", "points_written_ok", "req"})
+			So(queries, ShouldEqual, 0)
+		})
+		Convey("keeps names of newer releases reported by diagnostics", func() {
+			version = "1.1.1"
+			_, err := influxdbPlugin.getDiagnostics(context.Background(), influxdbPlugin.endpoints[0])
+			So(err, ShouldBeNil)
+			So(collect(), ShouldResemble, []string{"write_req", "points_written_ok", "req"})
+			So(queries, ShouldEqual, 1)
+		})
+		Convey("keeps names when normalisation is disabled", func() {
+			influxdbPlugin.normalizeNames = false
+			So(collect(), ShouldResemble, []string{"write_req", "points_written_ok", "req"})
+			So(queries, ShouldEqual, 0)
+		})
+	})
+}
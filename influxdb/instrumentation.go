@@ -0,0 +1,153 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// sources of metrics of InfluxDB instance
+const (
+	// sourceStats is the query "SHOW STATS"
+	sourceStats = "stats"
+	// sourceDiagnostics is the query "SHOW DIAGNOSTICS"
+	sourceDiagnostics = "diagnostics"
+	// sourceDebugVars is the request of /debug/vars endpoint, alternative to the query "SHOW STATS"
+	sourceDebugVars = "debug_vars"
+	// sourcePrometheus is the request of Prometheus endpoint /metrics of InfluxDB 2.x
+	sourcePrometheus = "prometheus"
+	// sourcePing is the probe with /ping endpoint
+	sourcePing = "ping"
+)
+
+// scrape describes the last query of a single source of metrics
+type scrape struct {
+	duration time.Duration
+	// bytes is the size of the response, series and metrics are the numbers of series in the response and of metrics built from them
+	bytes   int
+	series  int
+	metrics int
+}
+
+// scrapeStats holds metrics of collecting from a single InfluxDB instance, reported in namespace of collector
+type scrapeStats struct {
+	sync.Mutex
+	// scrapes holds the last query of each source, diagnostics read from cache are not queried
+	scrapes map[string]scrape
+	// lastSuccess is the time of the last collection without failed queries, zero when there has been none
+	lastSuccess time.Time
+	// failures is the number of consecutive collections with failed queries
+	failures int64
+	up       bool
+	// ping is the result of the last probe with /ping endpoint, nil when the instance has not been probed
+	ping *pingResult
+}
+
+// record stores the last query of source `source`
+func (s *scrapeStats) record(source string, sc scrape) {
+	s.Lock()
+	defer s.Unlock()
+	if s.scrapes == nil {
+		s.scrapes = map[string]scrape{}
+	}
+	s.scrapes[source] = sc
+}
+
+// recordPing stores the result of the last probe with /ping endpoint
+func (s *scrapeStats) recordPing(res pingResult) {
+	s.Lock()
+	defer s.Unlock()
+	s.ping = &res
+}
+
+// lastPing returns the result of the last probe with /ping endpoint
+func (s *scrapeStats) lastPing() pingResult {
+	s.Lock()
+	defer s.Unlock()
+	if s.ping == nil {
+		return pingResult{}
+	}
+	return *s.ping
+}
+
+// finish stores outcome of collection finished at `ts`, which succeeded when none of its queries failed
+func (s *scrapeStats) finish(succeeded bool, ts time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	s.up = succeeded
+	if succeeded {
+		s.lastSuccess = ts
+		s.failures = 0
+		return
+	}
+	s.failures++
+}
+
+// metrics returns metrics of collecting from InfluxDB instance `instance`
+func (s *scrapeStats) metrics(instance string) []plugin.Metric {
+	s.Lock()
+	defer s.Unlock()
+	tags := withInstance(nil, instance)
+	collectorMetric := func(data interface{}, elements ...string) plugin.Metric {
+		ns := plugin.NewNamespace(nsVendor, nsClass, nsTypeCollector).AddStaticElements(elements...)
+		return plugin.Metric{Namespace: ns, Data: data, Tags: tags}
+	}
+
+	up := int64(0)
+	if s.up {
+		up = 1
+	}
+	mts := []plugin.Metric{
+		collectorMetric(up, "up"),
+		collectorMetric(s.failures, "consecutive_failures"),
+	}
+	if !s.lastSuccess.IsZero() {
+		mts = append(mts, collectorMetric(s.lastSuccess.Unix(), "last_success_unix"))
+	}
+	if s.ping != nil {
+		reachable := int64(0)
+		if s.ping.reachable {
+			reachable = 1
+			mts = append(mts, collectorMetric(s.ping.latency.Seconds(), sourcePing, "latency_seconds"))
+		}
+		mts = append(mts, collectorMetric(reachable, sourcePing, "reachable"))
+		if s.ping.version != "" {
+			mts = append(mts, collectorMetric(s.ping.version, sourcePing, "version"))
+		}
+		if s.ping.build != "" {
+			mts = append(mts, collectorMetric(s.ping.build, sourcePing, "build"))
+		}
+	}
+
+	sources := make([]string, 0, len(s.scrapes))
+	for source := range s.scrapes {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		sc := s.scrapes[source]
+		mts = append(mts,
+			collectorMetric(sc.duration.Seconds(), source, "scrape_duration_seconds"),
+			collectorMetric(int64(sc.bytes), source, "response_bytes"),
+			collectorMetric(int64(sc.series), source, "series"),
+			collectorMetric(int64(sc.metrics), source, "metrics"),
+		)
+	}
+	return mts
+}
@@ -0,0 +1,152 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScrapeStats(t *testing.T) {
+	Convey("Collecting metrics of collector", t, func() {
+		var mutex sync.Mutex
+		down := false
+		getFlakyMockHTTPResponse := func(ctx context.Context, url string) ([]byte, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if down {
+				return nil, errors.New("connection refused")
+			}
+			return getMockHTTPResponse(ctx, url)
+		}
+		setDown := func(value bool) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			down = value
+		}
+		influxdbPlugin := &influxdbCollector{
+			getResponse:    getFlakyMockHTTPResponse,
+			endpoints:      []*endpoint{newMockEndpoint("stats", "diagnostics")},
+			diagnosticsTTL: time.Hour,
+		}
+		mts := []plugin.Metric{
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "collector", "up")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "collector", "consecutive_failures")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "collector", "last_success_unix")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "collector", "*", "*")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "diagn", "system", "PID")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "req")},
+		}
+		collect := func() (map[string]interface{}, error) {
+			results, err := influxdbPlugin.CollectMetrics(mts)
+			values := map[string]interface{}{}
+			for _, mt := range results {
+				So(mt.Tags[tagInstance], ShouldEqual, "hostname:1234")
+				values[mt.Namespace.String()] = mt.Data
+			}
+			return values, err
+		}
+
+		before := time.Now().Unix()
+		values, err := collect()
+		So(err, ShouldBeNil)
+		So(values["/intel/influxdb/collector/up"], ShouldEqual, int64(1))
+		So(values["/intel/influxdb/collector/consecutive_failures"], ShouldEqual, int64(0))
+		So(values["/intel/influxdb/collector/last_success_unix"], ShouldBeGreaterThanOrEqualTo, before)
+		So(values["/intel/influxdb/collector/stats/response_bytes"], ShouldEqual, int64(len(mockStatResults)))
+		So(values["/intel/influxdb/collector/stats/series"], ShouldEqual, int64(strings.Count(mockStatResults, `"name"`)))
+		So(values["/intel/influxdb/collector/stats/metrics"], ShouldBeGreaterThan, 0)
+		So(values["/intel/influxdb/collector/stats/scrape_duration_seconds"], ShouldBeGreaterThanOrEqualTo, 0)
+		So(values["/intel/influxdb/collector/diagnostics/response_bytes"], ShouldEqual, int64(len(mockDiagnosticResults)))
+		So(values["/intel/influxdb/collector/diagnostics/series"], ShouldEqual, int64(strings.Count(mockDiagnosticResults, `"name"`)))
+		diagnosticsDuration := values["/intel/influxdb/collector/diagnostics/scrape_duration_seconds"]
+		lastSuccess := values["/intel/influxdb/collector/last_success_unix"]
+
+		Convey("cached diagnostics do not change metrics of their last query", func() {
+			values, err := collect()
+			So(err, ShouldBeNil)
+			So(values["/intel/influxdb/collector/diagnostics/scrape_duration_seconds"], ShouldEqual, diagnosticsDuration)
+		})
+
+		Convey("failures of InfluxDB are counted", func() {
+			setDown(true)
+			influxdbPlugin.endpoints[0].diagnostics.stale = true
+			collect()
+			values, err := collect()
+			So(err, ShouldBeNil)
+			So(values["/intel/influxdb/collector/up"], ShouldEqual, int64(0))
+			So(values["/intel/influxdb/collector/consecutive_failures"], ShouldEqual, int64(2))
+			So(values["/intel/influxdb/collector/last_success_unix"], ShouldEqual, lastSuccess)
+			So(values, ShouldNotContainKey, "/intel/influxdb/diagn/system/PID")
+
+			Convey("until InfluxDB is reachable again", func() {
+				setDown(false)
+				values, err := collect()
+				So(err, ShouldBeNil)
+				So(values["/intel/influxdb/collector/up"], ShouldEqual, int64(1))
+				So(values["/intel/influxdb/collector/consecutive_failures"], ShouldEqual, int64(0))
+				So(values["/intel/influxdb/diagn/system/PID"], ShouldNotBeNil)
+			})
+		})
+
+		Convey("collection fails when InfluxDB is down and metrics of collector are not requested", func() {
+			setDown(true)
+			influxdbPlugin.endpoints[0].diagnostics.stale = true
+			results, err := influxdbPlugin.CollectMetrics(mts[4:])
+			So(err, ShouldNotBeNil)
+			So(results, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Reporting failures of collection", t, func() {
+		stats := &scrapeStats{}
+		ts := time.Unix(1500000000, 0)
+		values := func() map[string]interface{} {
+			res := map[string]interface{}{}
+			for _, mt := range stats.metrics("hostname:1234") {
+				res[mt.Namespace.String()] = mt.Data
+			}
+			return res
+		}
+
+		So(values(), ShouldResemble, map[string]interface{}{
+			"/intel/influxdb/collector/up":                   int64(0),
+			"/intel/influxdb/collector/consecutive_failures": int64(0),
+		})
+
+		stats.finish(true, ts)
+		stats.record(sourceStats, scrape{duration: 1500 * time.Millisecond, bytes: 2048, series: 3, metrics: 20})
+		stats.finish(false, ts.Add(time.Minute))
+		stats.finish(false, ts.Add(2*time.Minute))
+		So(values(), ShouldResemble, map[string]interface{}{
+			"/intel/influxdb/collector/up":                            int64(0),
+			"/intel/influxdb/collector/consecutive_failures":          int64(2),
+			"/intel/influxdb/collector/last_success_unix":             int64(1500000000),
+			"/intel/influxdb/collector/stats/scrape_duration_seconds": 1.5,
+			"/intel/influxdb/collector/stats/response_bytes":          int64(2048),
+			"/intel/influxdb/collector/stats/series":                  int64(3),
+			"/intel/influxdb/collector/stats/metrics":                 int64(20),
+		})
+	})
+}
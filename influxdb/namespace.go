@@ -0,0 +1,90 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"strings"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// nsWildcard is the value of dynamic namespace element in metric types
+const nsWildcard = "*"
+
+// dynamicElement describes series tag exposed as dynamic element of metric namespace
+type dynamicElement struct {
+	tag         string
+	name        string
+	description string
+}
+
+var (
+	// shardElements are exposed by statistics of shards and their storage engines (`shard`, `tsm1_*`)
+	shardElements = []dynamicElement{
+		{tag: "engine", name: "engine", description: "storage engine of the shard"},
+		{tag: "database", name: "database", description: "name of database"},
+		{tag: "retentionPolicy", name: "retention_policy", description: "name of retention policy"},
+		{tag: "id", name: "shard_id", description: "identifier of the shard"},
+	}
+	// databaseElements are exposed by statistics of databases (`database`)
+	databaseElements = []dynamicElement{
+		{tag: "database", name: "database", description: "name of database"},
+	}
+)
+
+// dynamicElements returns dynamic namespace elements of statistics module `module`
+func dynamicElements(module string) []dynamicElement {
+	switch {
+	case module == "shard" || strings.HasPrefix(module, "tsm1_"):
+		return shardElements
+	case module == "database":
+		return databaseElements
+	}
+	return nil
+}
+
+// statNamespace returns namespace of statistic `column` of module `module`,
+// values of tags identifying the series are set as dynamic elements,
+// e.g. /intel/influxdb/stat/shard/<engine>/<database>/<retention_policy>/<shard_id>/writePointsOk
+func statNamespace(module string, tags map[string]string, column string) plugin.Namespace {
+	ns := plugin.NewNamespace(nsVendor, nsClass, nsTypeStats, module)
+
+	elements := dynamicElements(module)
+	for _, e := range elements {
+		if _, ok := tags[e.tag]; !ok {
+			// series cannot be identified, expose it with static namespace
+			elements = nil
+			break
+		}
+	}
+	for _, e := range elements {
+		ns = ns.AddDynamicElement(e.name, e.description)
+		ns[len(ns)-1].Value = tags[e.tag]
+	}
+
+	return ns.AddStaticElement(column)
+}
+
+// metricType returns copy of namespace `ns` with values of dynamic elements replaced by wildcard
+func metricType(ns plugin.Namespace) plugin.Namespace {
+	res := make(plugin.Namespace, len(ns))
+	copy(res, ns)
+	for i := range res {
+		if res[i].IsDynamic() {
+			res[i].Value = nsWildcard
+		}
+	}
+	return res
+}
@@ -0,0 +1,63 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"strconv"
+	"strings"
+)
+
+// statisticAliases maps names of statistics reported by InfluxDB releases older than 1.0 to their canonical names
+// (as reported by InfluxDB 1.x) per statistics module, only names which differ from plain camelCase conversion are listed
+var statisticAliases = map[string]map[string]string{
+	"httpd": {
+		"points_written_ok": "pointsWrittenOK",
+	},
+}
+
+// canonicalStatistic returns canonical name of statistic `column` of module `module` reported by InfluxDB older than 1.0,
+// snake_case names are converted to camelCase, e.g. `write_req` to `writeReq`
+func canonicalStatistic(module string, column string) string {
+	if name, ok := statisticAliases[module][column]; ok {
+		return name
+	}
+	if !strings.Contains(column, "_") {
+		return column
+	}
+
+	parts := strings.Split(column, "_")
+	name := parts[0]
+	for _, part := range parts[1:] {
+		if part == "" {
+			continue
+		}
+		name += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return name
+}
+
+// isLegacyVersion checks if `version` (diagn/build/Version) is a release older than 1.0 which reports snake_case names
+func isLegacyVersion(version string) (bool, error) {
+	major, err := majorVersion(version)
+	if err != nil {
+		return false, err
+	}
+	return major < 1, nil
+}
+
+// majorVersion returns major number of InfluxDB version `version`, e.g. 1 for `1.8.10` or `v1.8.10`
+func majorVersion(version string) (int, error) {
+	return strconv.Atoi(strings.SplitN(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".", 2)[0])
+}
@@ -0,0 +1,133 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// headerVersion is the header of response of InfluxDB holding its version
+	headerVersion = "X-Influxdb-Version"
+	// headerBuild is the header of response of InfluxDB holding its build (e.g. OSS)
+	headerBuild = "X-Influxdb-Build"
+)
+
+type getHeaders func(ctx context.Context, url string) (http.Header, error)
+
+// pingResult is the outcome of the last probe of InfluxDB instance with /ping endpoint
+type pingResult struct {
+	// reachable is set when InfluxDB responded, even with an error status
+	reachable bool
+	latency   time.Duration
+	version   string
+	build     string
+	err       error
+}
+
+// pingURL returns URL of /ping endpoint of InfluxDB instance available under `address`
+func pingURL(scheme string, address string) (*url.URL, error) {
+	return url.Parse(fmt.Sprintf("%s://%s/ping", scheme, address))
+}
+
+// ping probes InfluxDB instance `ep` with /ping endpoint, the result is reported by metrics of collector
+func (ic *influxdbCollector) ping(ctx context.Context, ep *endpoint) ([]plugin.Metric, error) {
+	start := time.Now()
+	header, err := ic.getPing(ctx, ep.urlPing.String())
+	res := pingResult{latency: time.Since(start), err: err}
+	_, responded := err.(*responseError)
+	res.reachable = err == nil || responded
+	if header != nil {
+		res.version, res.build = header.Get(headerVersion), header.Get(headerBuild)
+	}
+	ep.scrapes.recordPing(res)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "ping",
+			"instance": ep.instance,
+			"err":      err,
+		}).Error("Cannot ping InfluxDB")
+		return nil, err
+	}
+	return nil, nil
+}
+
+// probe pings all InfluxDB instances and logs the outcome, so problems with connection to them
+// are reported before the first query; failures are not fatal, as instances may be started later
+func (ic *influxdbCollector) probe() {
+	ctx, cancel := context.WithTimeout(context.Background(), ic.probeTimeout())
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, ep := range ic.endpoints {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+			ic.ping(ctx, ep)
+			logPingResult(ep.instance, ep.scrapes.lastPing(), ic.sourceEnabled(sourcePrometheus))
+		}(ep)
+	}
+	wg.Wait()
+}
+
+// probeTimeout returns deadline of probe, so initialization is not blocked by unresponsive instances
+// when requests have no timeout: it is the timeout of requests, collect_timeout or the default timeout
+func (ic *influxdbCollector) probeTimeout() time.Duration {
+	if ic.client != nil && ic.client.Timeout > 0 {
+		return ic.client.Timeout
+	}
+	if ic.collectTimeout > 0 {
+		return ic.collectTimeout
+	}
+	return defaultTimeout
+}
+
+// logPingResult explains the result of probe of InfluxDB instance `instance`,
+// `prometheus` tells if metrics of InfluxDB 2.x are read from its Prometheus endpoint
+func logPingResult(instance string, res pingResult, prometheus bool) {
+	fields := log.Fields{
+		"block":    "init",
+		"function": "probe",
+		"instance": instance,
+		"latency":  res.latency.String(),
+		"version":  res.version,
+		"build":    res.build,
+	}
+	switch {
+	case !res.reachable:
+		fields["err"] = res.err
+		log.WithFields(fields).Warn("InfluxDB is unreachable, check host, port, scheme and TLS settings")
+	case isAuthError(res.err):
+		fields["err"] = res.err
+		log.WithFields(fields).Warn("InfluxDB is reachable, but rejected credentials, check user, password, auth_method and token")
+	case res.err != nil:
+		fields["err"] = res.err
+		log.WithFields(fields).Warn("InfluxDB is reachable, but responded to ping with an error")
+	default:
+		if major, err := majorVersion(res.version); err == nil && major >= 2 && !prometheus {
+			log.WithFields(fields).Warn("InfluxDB 2.x does not support SHOW STATS and SHOW DIAGNOSTICS, set source to prometheus to collect its metrics")
+			return
+		}
+		log.WithFields(fields).Info("InfluxDB is reachable")
+	}
+}
@@ -0,0 +1,213 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	log "github.com/sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// getMockPingResponse returns headers of InfluxDB 1.8 responding to ping
+func getMockPingResponse(ctx context.Context, url string) (http.Header, error) {
+	header := http.Header{}
+	header.Set(headerVersion, "1.8.10")
+	header.Set(headerBuild, "OSS")
+	return header, nil
+}
+
+func getUnreachableMockPingResponse(ctx context.Context, url string) (http.Header, error) {
+	return nil, errors.New("connection refused")
+}
+
+// newPingServer returns InfluxDB mock responding to ping with status `status`
+func newPingServer(status int) (*httptest.Server, plugin.Config) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerVersion, "1.8.10")
+		w.Header().Set(headerBuild, "OSS")
+		if r.URL.Path != "/ping" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	portNum, _ := strconv.ParseInt(port, 10, 64)
+	cfg := getMockConfig()
+	cfg["host"], cfg["port"] = host, portNum
+	return ts, cfg
+}
+
+func TestPing(t *testing.T) {
+	Convey("Pinging InfluxDB", t, func() {
+		influxdbPlugin := New().(*influxdbCollector)
+		collect := func(cfg plugin.Config) map[string]interface{} {
+			So(influxdbPlugin.init(cfg), ShouldBeNil)
+			_, err := influxdbPlugin.ping(context.Background(), influxdbPlugin.endpoints[0])
+			values := map[string]interface{}{"err": err}
+			for _, mt := range influxdbPlugin.endpoints[0].scrapes.metrics(influxdbPlugin.endpoints[0].instance) {
+				values[mt.Namespace.String()] = mt.Data
+			}
+			return values
+		}
+
+		Convey("records latency, version and build of reachable instance", func() {
+			ts, cfg := newPingServer(http.StatusNoContent)
+			defer ts.Close()
+			values := collect(cfg)
+			So(values["err"], ShouldBeNil)
+			So(values["/intel/influxdb/collector/ping/reachable"], ShouldEqual, int64(1))
+			So(values["/intel/influxdb/collector/ping/latency_seconds"], ShouldBeGreaterThan, 0)
+			So(values["/intel/influxdb/collector/ping/version"], ShouldEqual, "1.8.10")
+			So(values["/intel/influxdb/collector/ping/build"], ShouldEqual, "OSS")
+		})
+		Convey("tells instance rejecting credentials from unreachable one", func() {
+			ts, cfg := newPingServer(http.StatusUnauthorized)
+			defer ts.Close()
+			values := collect(cfg)
+			So(isAuthError(values["err"].(error)), ShouldBeTrue)
+			So(values["/intel/influxdb/collector/ping/reachable"], ShouldEqual, int64(1))
+			So(values["/intel/influxdb/collector/ping/version"], ShouldEqual, "1.8.10")
+
+			ts.Close()
+			values = collect(cfg)
+			So(values["err"], ShouldNotBeNil)
+			So(values["/intel/influxdb/collector/ping/reachable"], ShouldEqual, int64(0))
+			So(values, ShouldNotContainKey, "/intel/influxdb/collector/ping/latency_seconds")
+		})
+	})
+
+	Convey("Probing InfluxDB during initialization", t, func() {
+		var output bytes.Buffer
+		log.SetOutput(&output)
+		defer log.SetOutput(os.Stderr)
+
+		Convey("reports reachable instance with its version", func() {
+			ts, cfg := newPingServer(http.StatusNoContent)
+			defer ts.Close()
+			So(New().(*influxdbCollector).init(cfg), ShouldBeNil)
+			So(output.String(), ShouldContainSubstring, "InfluxDB is reachable")
+			So(output.String(), ShouldContainSubstring, "1.8.10")
+		})
+		Convey("reports rejected credentials", func() {
+			ts, cfg := newPingServer(http.StatusForbidden)
+			defer ts.Close()
+			So(New().(*influxdbCollector).init(cfg), ShouldBeNil)
+			So(output.String(), ShouldContainSubstring, "rejected credentials")
+		})
+		Convey("reports unreachable instance without failing", func() {
+			ts, cfg := newPingServer(http.StatusNoContent)
+			ts.Close()
+			So(New().(*influxdbCollector).init(cfg), ShouldBeNil)
+			So(output.String(), ShouldContainSubstring, "InfluxDB is unreachable")
+		})
+		Convey("gives up on unresponsive instance when requests have no timeout", func() {
+			release := make(chan struct{})
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-release
+			}))
+			defer ts.Close()
+			defer close(release)
+			cfg := getMockConfig()
+			host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+			portNum, _ := strconv.ParseInt(port, 10, 64)
+			cfg["host"], cfg["port"] = host, portNum
+			cfg["timeout"] = "0s"
+			cfg["collect_timeout"] = "100ms"
+			started := time.Now()
+			So(New().(*influxdbCollector).init(cfg), ShouldBeNil)
+			So(time.Since(started), ShouldBeLessThan, defaultTimeout)
+			So(output.String(), ShouldContainSubstring, "InfluxDB is unreachable")
+		})
+		Convey("can be disabled", func() {
+			ts, cfg := newPingServer(http.StatusNoContent)
+			defer ts.Close()
+			cfg["ping"] = false
+			So(New().(*influxdbCollector).init(cfg), ShouldBeNil)
+			So(output.String(), ShouldNotContainSubstring, "InfluxDB is reachable")
+		})
+	})
+
+	Convey("Collecting results of ping", t, func() {
+		influxdbPlugin := &influxdbCollector{
+			getResponse: getMockHTTPResponse,
+			getPing:     getMockPingResponse,
+			endpoints:   []*endpoint{newMockEndpoint("stats", "diagnostics")},
+		}
+		influxdbPlugin.sources = []source{pingSource{influxdbPlugin}, diagnosticsSource{influxdbPlugin}, statsSource{influxdbPlugin}}
+		mts := []plugin.Metric{
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "collector", "ping", "*")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "collector", "errors")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "req")},
+		}
+		collect := func() (map[string]interface{}, error) {
+			results, err := influxdbPlugin.CollectMetrics(mts)
+			values := map[string]interface{}{}
+			for _, mt := range results {
+				values[mt.Namespace.String()] = mt.Data
+			}
+			return values, err
+		}
+
+		Convey("returns them along with metrics of InfluxDB", func() {
+			values, err := collect()
+			So(err, ShouldBeNil)
+			So(values["/intel/influxdb/collector/ping/reachable"], ShouldEqual, int64(1))
+			So(values["/intel/influxdb/collector/ping/version"], ShouldEqual, "1.8.10")
+			So(values["/intel/influxdb/collector/errors"], ShouldEqual, int64(0))
+			So(values["/intel/influxdb/stat/httpd/req"], ShouldNotBeNil)
+		})
+		Convey("counts failed ping as failed query", func() {
+			influxdbPlugin.getPing = getUnreachableMockPingResponse
+			values, err := collect()
+			So(err, ShouldBeNil)
+			So(values["/intel/influxdb/collector/ping/reachable"], ShouldEqual, int64(0))
+			So(values["/intel/influxdb/collector/errors"], ShouldEqual, int64(1))
+		})
+		Convey("sends ping only when metrics of collector are requested", func() {
+			influxdbPlugin.getPing = nil
+			_, err := influxdbPlugin.CollectMetrics(mts[2:])
+			So(err, ShouldBeNil)
+		})
+		Convey("does not hide failure of all queries for metrics", func() {
+			influxdbPlugin.getResponse = getUnreachableMockHTTPResponse
+			_, err := influxdbPlugin.GetMetricTypes(getMockConfig())
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Getting major version of InfluxDB", t, func() {
+		for version, major := range map[string]int{"1.8.10": 1, "v2.7.1": 2, "0.13.0": 0, " 1.x ": 1} {
+			n, err := majorVersion(version)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, major)
+		}
+		_, err := majorVersion("unknown")
+		So(err, ShouldNotBeNil)
+	})
+}
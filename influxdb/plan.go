@@ -0,0 +1,117 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// reModule matches names of statistics modules which can be used in `SHOW STATS FOR` statement
+var reModule = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// queryPlan describes queries needed to collect requested metrics
+type queryPlan struct {
+	diagnostics bool
+	statistics  bool
+	// prometheus is set when metrics of Prometheus endpoint of InfluxDB 2.x are requested
+	prometheus bool
+	// derived is set when rates or deltas of counters are requested
+	derived bool
+	// collector is set when metrics of the collection itself are requested
+	collector bool
+	// modules lists statistics modules to query, empty list means all modules
+	modules []string
+	// discovery is set when metric types are discovered
+	discovery bool
+}
+
+// fullPlan is the plan querying all available metrics
+var fullPlan = queryPlan{diagnostics: true, statistics: true, prometheus: true, derived: true, collector: true}
+
+// discoveryPlan is the plan querying all metrics exposed by InfluxDB to discover metric types
+var discoveryPlan = queryPlan{diagnostics: true, statistics: true, prometheus: true, collector: true, discovery: true}
+
+// newQueryPlan returns plan of queries needed to collect requested metrics `mts`,
+// `cachedDiagnostics` is set when diagnostics are cached, so restarts of InfluxDB must be detected
+func newQueryPlan(mts []plugin.Metric, cachedDiagnostics bool) queryPlan {
+	plan := queryPlan{}
+	modules := map[string]bool{}
+	allModules := false
+
+	for _, mt := range mts {
+		ns := mt.Namespace.Strings()
+		if len(ns) < 3 || ns[2] == nsWildcard {
+			return fullPlan
+		}
+		switch ns[2] {
+		case nsTypeCollector:
+			plan.collector = true
+		case nsTypeDiagn:
+			plan.diagnostics = true
+		case nsTypeProm:
+			plan.prometheus = true
+		case nsTypeStats:
+			plan.statistics = true
+			plan.derived = plan.derived || isDerived(mt.Namespace)
+			if len(ns) < 4 || !reModule.MatchString(ns[3]) {
+				allModules = true
+			} else {
+				modules[ns[3]] = true
+			}
+		}
+	}
+
+	if plan.diagnostics && cachedDiagnostics && !plan.statistics {
+		// restarts of InfluxDB, which invalidate cached diagnostics, are detected from runtime statistics
+		plan.statistics = true
+	}
+
+	if !plan.diagnostics && !plan.statistics && !plan.prometheus {
+		// only metrics of the collection itself are requested, check instances with the cheapest query,
+		// i.e. statistics of module runtime, which are needed to detect restarts anyway
+		plan.statistics = true
+		plan.prometheus = true
+	}
+
+	if plan.statistics && !allModules {
+		if plan.diagnostics || plan.derived || plan.collector {
+			// runtime statistics are used to detect restarts, which invalidate cached diagnostics,
+			// reset counters and are reported by metrics of collector
+			modules["runtime"] = true
+		}
+		for module := range modules {
+			plan.modules = append(plan.modules, module)
+		}
+		sort.Strings(plan.modules)
+	}
+
+	return plan
+}
+
+// statsStatement returns statement querying statistics of given modules, or all of them when `modules` is empty
+func statsStatement(modules []string) string {
+	if len(modules) == 0 {
+		return "show stats"
+	}
+	statements := []string{}
+	for _, module := range modules {
+		statements = append(statements, "show stats for '"+module+"'")
+	}
+	return strings.Join(statements, "; ")
+}
@@ -0,0 +1,269 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// nsTypeProm is the namespace type of metrics of InfluxDB 2.x read from its Prometheus endpoint /metrics
+	nsTypeProm = "prom"
+
+	// types of Prometheus metric families
+	promCounter   = "counter"
+	promGauge     = "gauge"
+	promHistogram = "histogram"
+	promSummary   = "summary"
+	promUntyped   = "untyped"
+
+	// promAllocTotal is the counter of bytes allocated by InfluxDB, which decreases only when the process restarts
+	promAllocTotal = "go_memstats_alloc_bytes_total"
+)
+
+// promFamily describes a Prometheus metric family given by `# HELP` and `# TYPE` lines
+type promFamily struct {
+	help string
+	typ  string
+}
+
+// promSample is a single sample of Prometheus text format, e.g. `http_api_requests_total{method="GET"} 5`
+type promSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// metricsURL returns URL of Prometheus endpoint /metrics of InfluxDB instance available under `address`
+func metricsURL(scheme string, address string) (*url.URL, error) {
+	return url.Parse(fmt.Sprintf("%s://%s/metrics", scheme, address))
+}
+
+// queryPrometheus reads metrics of InfluxDB 2.x instance `ep` from its Prometheus endpoint /metrics,
+// metric families are mapped into namespace /intel/influxdb/prom/<family> and their labels into tags
+func (ic *influxdbCollector) queryPrometheus(ctx context.Context, ep *endpoint) ([]plugin.Metric, error) {
+	mts := []plugin.Metric{}
+	start := time.Now()
+	sc := scrape{}
+	defer func() {
+		sc.duration = time.Since(start)
+		sc.metrics = len(mts)
+		ep.scrapes.record(sourcePrometheus, sc)
+	}()
+	response, err := ic.getResponse(ctx, ep.urlMetrics.String())
+	sc.bytes = len(response)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"block":    "monitor",
+			"function": "queryPrometheus",
+			"instance": ep.instance,
+			"err":      err,
+		}).Error("Cannot get response from InfluxDB")
+		return nil, err
+	}
+	families, samples, err := parsePrometheus(response)
+	if err != nil {
+		return nil, err
+	}
+	sc.series = len(samples)
+
+	for _, s := range samples {
+		if s.name == promAllocTotal && ep.diagnostics.observeTotalAlloc(int64(s.value)) {
+			log.WithFields(log.Fields{
+				"block":    "monitor",
+				"function": "queryPrometheus",
+				"instance": ep.instance,
+			}).Info("InfluxDB process has been restarted")
+		}
+		// values which cannot be represented in JSON are skipped, as nulls of statistics are
+		if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+			continue
+		}
+		family, suffix := promFamilyOf(s.name, families)
+		if !ic.filter.allowsSeries(family, s.labels) {
+			continue
+		}
+		ns := plugin.NewNamespace(nsVendor, nsClass, nsTypeProm, family)
+		if suffix != "" {
+			ns = ns.AddStaticElement(suffix)
+		}
+		mts = append(mts, plugin.Metric{
+			Namespace:   ns,
+			Data:        s.value,
+			Tags:        withInstance(s.labels, ep.instance),
+			Description: families[family].help,
+			Unit:        promUnit(family),
+		})
+	}
+	return mts, nil
+}
+
+// promFamilyOf returns family of sample `name` and the element distinguishing samples of histograms and summaries:
+// `bucket`, `sum` and `count` for samples with these suffixes and `quantile` for quantiles of summaries
+func promFamilyOf(name string, families map[string]promFamily) (string, string) {
+	if f, ok := families[name]; ok {
+		if f.typ == promSummary {
+			return name, "quantile"
+		}
+		return name, ""
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		family := strings.TrimSuffix(name, suffix)
+		if f, ok := families[family]; ok && (f.typ == promHistogram || f.typ == promSummary) {
+			return family, suffix[1:]
+		}
+	}
+	return name, ""
+}
+
+// promUnit returns unit of metric family `family` following Prometheus naming conventions
+func promUnit(family string) string {
+	name := strings.TrimSuffix(family, "_total")
+	switch {
+	case strings.HasSuffix(name, "_seconds"):
+		return unitSeconds
+	case strings.HasSuffix(name, "_bytes"):
+		return unitBytes
+	}
+	return unitNone
+}
+
+// parsePrometheus parses Prometheus text exposition format `data`,
+// returns metric families described by `# HELP` and `# TYPE` lines and all samples
+func parsePrometheus(data []byte) (map[string]promFamily, []promSample, error) {
+	families := map[string]promFamily{}
+	samples := []promSample{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.SplitN(strings.TrimSpace(line[1:]), " ", 3)
+			if len(fields) < 3 || (fields[0] != "HELP" && fields[0] != "TYPE") {
+				// other comments are ignored
+				continue
+			}
+			f := families[fields[1]]
+			if fields[0] == "HELP" {
+				f.help = unescapePrometheus(fields[2])
+			} else {
+				f.typ = strings.TrimSpace(fields[2])
+			}
+			families[fields[1]] = f
+			continue
+		}
+		s, err := parsePromSample(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Cannot parse metrics of InfluxDB, line %d: %s", lineNum, err.Error())
+		}
+		samples = append(samples, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("Cannot parse metrics of InfluxDB, err=%s", err.Error())
+	}
+	return families, samples, nil
+}
+
+// parsePromSample parses sample line `name{label="value",...} value [timestamp]`
+func parsePromSample(line string) (promSample, error) {
+	s := promSample{labels: map[string]string{}}
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return s, fmt.Errorf("invalid sample `%s`", line)
+	}
+	s.name = line[:end]
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		if rest, err = parsePromLabels(rest[1:], s.labels); err != nil {
+			return s, err
+		}
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return s, fmt.Errorf("invalid value of sample `%s`", s.name)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, fmt.Errorf("invalid value of sample `%s`: %s", s.name, err.Error())
+	}
+	s.value = value
+	return s, nil
+}
+
+// parsePromLabels parses labels `label="value",...}` into `labels`, returns the rest of line after the closing brace
+func parsePromLabels(line string, labels map[string]string) (string, error) {
+	for {
+		line = strings.TrimLeft(line, " \t,")
+		if strings.HasPrefix(line, "}") {
+			return line[1:], nil
+		}
+		eq := strings.Index(line, "=")
+		if eq <= 0 || len(line) < eq+2 || line[eq+1] != '"' {
+			return "", fmt.Errorf("invalid labels `%s`", line)
+		}
+		name := strings.TrimSpace(line[:eq])
+		line = line[eq+2:]
+
+		var value bytes.Buffer
+		closed := false
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			if c == '\\' && i+1 < len(line) {
+				i++
+				switch line[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(line[i])
+				}
+				continue
+			}
+			if c == '"' {
+				line = line[i+1:]
+				closed = true
+				break
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			return "", fmt.Errorf("unterminated value of label `%s`", name)
+		}
+		labels[name] = value.String()
+	}
+}
+
+// unescapePrometheus unescapes text of `# HELP` line
+func unescapePrometheus(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(s)
+}
@@ -0,0 +1,250 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// mockPrometheusMetrics is a part of response of /metrics of InfluxDB 2.x
+const mockPrometheusMetrics = `# HELP go_gc_duration_seconds A summary of the pause duration of garbage collection cycles.
+# TYPE go_gc_duration_seconds summary
+go_gc_duration_seconds{quantile="0"} 2.6e-05
+go_gc_duration_seconds{quantile="1"} 0.000512
+go_gc_duration_seconds_sum 0.0421
+go_gc_duration_seconds_count 104
+# HELP go_memstats_alloc_bytes_total Total number of bytes allocated, even if freed.
+# TYPE go_memstats_alloc_bytes_total counter
+go_memstats_alloc_bytes_total %d
+# HELP http_api_requests_total Number of http requests received
+# TYPE http_api_requests_total counter
+http_api_requests_total{handler="platform",method="GET",path="/api/v2/buckets",response_code="200",status="2XX",user_agent="Mozilla \"compatible\""} 5
+http_api_requests_total{handler="platform",method="POST",path="/api/v2/write",response_code="204",status="2XX",user_agent="Telegraf"} 1042 1700000000000
+# HELP http_api_request_duration_seconds Time taken to respond to HTTP request
+# TYPE http_api_request_duration_seconds histogram
+http_api_request_duration_seconds_bucket{handler="platform",le="0.005"} 3
+http_api_request_duration_seconds_bucket{handler="platform",le="+Inf"} 6
+http_api_request_duration_seconds_sum{handler="platform"} 0.0183
+http_api_request_duration_seconds_count{handler="platform"} 6
+# HELP influxdb_info Information about the influxdb environment.
+# TYPE influxdb_info gauge
+influxdb_info{arch="amd64",build_date="2023-04-28T14:24:14Z",commit="407fa622e9",cpus="8",os="linux",version="v2.7.1"} 1
+# HELP storage_shard_disk_size Gauge of the disk size for the shard
+# TYPE storage_shard_disk_size gauge
+storage_shard_disk_size{bucket="c2b7f9d4a1e3f0a2",engine="tsm1",id="1",walPath="/var/lib/influxdb2/engine/wal/c2b7f9d4a1e3f0a2/autogen/1"} 20480
+# TYPE task_scheduler_current_execution untyped
+task_scheduler_current_execution NaN
+`
+
+func getPrometheusMockHTTPResponse(ctx context.Context, url string) ([]byte, error) {
+	if strings.HasPrefix(url, "metrics") {
+		return []byte(fmt.Sprintf(mockPrometheusMetrics, 43560664)), nil
+	}
+	return nil, errors.New("Not found, InfluxDB responded with status 404 Not Found")
+}
+
+func newMockPrometheusCollector() *influxdbCollector {
+	ep := newMockEndpoint("stats", "diagnostics")
+	ep.urlMetrics = &url.URL{Path: "metrics"}
+	ic := &influxdbCollector{
+		getResponse: getPrometheusMockHTTPResponse,
+		endpoints:   []*endpoint{ep},
+	}
+	ic.sources = []source{prometheusSource{ic}}
+	return ic
+}
+
+func TestPrometheus(t *testing.T) {
+	Convey("Parsing Prometheus text format", t, func() {
+		families, samples, err := parsePrometheus([]byte(fmt.Sprintf(mockPrometheusMetrics, 1024)))
+		So(err, ShouldBeNil)
+		So(len(samples), ShouldEqual, 14)
+		So(families["go_gc_duration_seconds"], ShouldResemble, promFamily{
+			help: "A summary of the pause duration of garbage collection cycles.",
+			typ:  promSummary,
+		})
+		So(families["task_scheduler_current_execution"].typ, ShouldEqual, promUntyped)
+
+		Convey("with labels holding escaped characters", func() {
+			So(samples[5].name, ShouldEqual, "http_api_requests_total")
+			So(samples[5].labels["user_agent"], ShouldEqual, `Mozilla "compatible"`)
+			So(samples[5].labels["path"], ShouldEqual, "/api/v2/buckets")
+			So(samples[5].value, ShouldEqual, 5)
+		})
+		Convey("with timestamps", func() {
+			So(samples[6].value, ShouldEqual, 1042)
+		})
+		Convey("assigning samples of histograms and summaries to their families", func() {
+			family, suffix := promFamilyOf("http_api_request_duration_seconds_bucket", families)
+			So(family, ShouldEqual, "http_api_request_duration_seconds")
+			So(suffix, ShouldEqual, "bucket")
+			family, suffix = promFamilyOf("go_gc_duration_seconds", families)
+			So(family, ShouldEqual, "go_gc_duration_seconds")
+			So(suffix, ShouldEqual, "quantile")
+			family, suffix = promFamilyOf("go_gc_duration_seconds_count", families)
+			So(suffix, ShouldEqual, "count")
+			family, suffix = promFamilyOf("http_api_requests_total", families)
+			So(family, ShouldEqual, "http_api_requests_total")
+			So(suffix, ShouldBeEmpty)
+		})
+		Convey("failing for invalid samples", func() {
+			for _, line := range []string{
+				`metric{label="value" 1`,
+				`metric{label=value} 1`,
+				`metric`,
+				`metric one`,
+				`{label="value"} 1`,
+			} {
+				_, _, err := parsePrometheus([]byte(line))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "line 1")
+			}
+		})
+	})
+
+	Convey("Collecting metrics of InfluxDB 2.x", t, func() {
+		influxdbPlugin := newMockPrometheusCollector()
+		collect := func(mts ...plugin.Metric) map[string][]plugin.Metric {
+			results, err := influxdbPlugin.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			res := map[string][]plugin.Metric{}
+			for _, mt := range results {
+				So(mt.Tags[tagInstance], ShouldEqual, "hostname:1234")
+				res[mt.Namespace.String()] = append(res[mt.Namespace.String()], mt)
+			}
+			return res
+		}
+
+		Convey("maps metric families into namespace and labels into tags", func() {
+			res := collect(plugin.Metric{Namespace: plugin.NewNamespace("intel", "influxdb", "prom", "*")})
+			So(len(res["/intel/influxdb/prom/http_api_requests_total"]), ShouldEqual, 2)
+			So(res["/intel/influxdb/prom/http_api_requests_total"][1].Data, ShouldEqual, 1042.0)
+			So(res["/intel/influxdb/prom/http_api_requests_total"][1].Tags["path"], ShouldEqual, "/api/v2/write")
+			So(res["/intel/influxdb/prom/storage_shard_disk_size"][0].Tags["bucket"], ShouldEqual, "c2b7f9d4a1e3f0a2")
+			So(res["/intel/influxdb/prom/influxdb_info"][0].Tags["version"], ShouldEqual, "v2.7.1")
+			So(res, ShouldNotContainKey, "/intel/influxdb/prom/task_scheduler_current_execution")
+		})
+		Convey("maps samples of histograms and summaries into elements of namespace", func() {
+			res := collect(plugin.Metric{Namespace: plugin.NewNamespace("intel", "influxdb", "prom", "*", "*")})
+			So(len(res["/intel/influxdb/prom/http_api_request_duration_seconds/bucket"]), ShouldEqual, 2)
+			So(res["/intel/influxdb/prom/http_api_request_duration_seconds/bucket"][1].Tags["le"], ShouldEqual, "+Inf")
+			So(res["/intel/influxdb/prom/http_api_request_duration_seconds/count"][0].Data, ShouldEqual, 6.0)
+			So(len(res["/intel/influxdb/prom/go_gc_duration_seconds/quantile"]), ShouldEqual, 2)
+			So(res["/intel/influxdb/prom/go_gc_duration_seconds/sum"][0].Data, ShouldEqual, 0.0421)
+		})
+		Convey("applies filter of modules to metric families", func() {
+			var err error
+			influxdbPlugin.filter.modules, err = newPatternFilter("http_*", "")
+			So(err, ShouldBeNil)
+			res := collect(plugin.Metric{Namespace: plugin.NewNamespace("intel", "influxdb", "prom", "*")})
+			So(res, ShouldContainKey, "/intel/influxdb/prom/http_api_requests_total")
+			So(res, ShouldNotContainKey, "/intel/influxdb/prom/influxdb_info")
+		})
+		Convey("does not query diagnostics", func() {
+			res := collect(
+				plugin.Metric{Namespace: plugin.NewNamespace("intel", "influxdb", "diagn", "system", "PID")},
+				plugin.Metric{Namespace: plugin.NewNamespace("intel", "influxdb", "collector", "errors")},
+			)
+			So(res["/intel/influxdb/collector/errors"][0].Data, ShouldEqual, int64(0))
+			So(res, ShouldNotContainKey, "/intel/influxdb/diagn/system/PID")
+		})
+		Convey("exposes metric types with help of their families", func() {
+			mts, err := influxdbPlugin.GetMetricTypes(getMockConfig())
+			So(err, ShouldBeNil)
+			types := map[string]plugin.Metric{}
+			for _, mt := range mts {
+				types[mt.Namespace.String()] = mt
+			}
+			So(types["/intel/influxdb/prom/http_api_requests_total"].Description, ShouldEqual, "Number of http requests received")
+			So(types["/intel/influxdb/prom/storage_shard_disk_size"].Unit, ShouldEqual, unitNone)
+			So(types["/intel/influxdb/prom/http_api_request_duration_seconds/sum"].Unit, ShouldEqual, unitSeconds)
+			So(types["/intel/influxdb/prom/go_memstats_alloc_bytes_total"].Unit, ShouldEqual, unitBytes)
+			So(types, ShouldContainKey, "/intel/influxdb/collector/prometheus/response_bytes")
+		})
+	})
+
+	Convey("Detecting restarts of InfluxDB 2.x", t, func() {
+		var mutex sync.Mutex
+		allocated := 43560664
+		influxdbPlugin := newMockPrometheusCollector()
+		influxdbPlugin.getResponse = func(ctx context.Context, url string) ([]byte, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return []byte(fmt.Sprintf(mockPrometheusMetrics, allocated)), nil
+		}
+		mts := []plugin.Metric{{Namespace: plugin.NewNamespace("intel", "influxdb", "collector", "restarts")}}
+
+		_, err := influxdbPlugin.CollectMetrics(mts)
+		So(err, ShouldBeNil)
+		mutex.Lock()
+		allocated = 4096
+		mutex.Unlock()
+		results, err := influxdbPlugin.CollectMetrics(mts)
+		So(err, ShouldBeNil)
+		So(results[0].Data, ShouldEqual, int64(1))
+	})
+
+	Convey("Reading /metrics of InfluxDB 2.x with API token", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerVersion, "v2.7.1")
+			switch {
+			case r.URL.Path == "/ping":
+				w.WriteHeader(http.StatusNoContent)
+			case r.URL.Path == "/metrics" && r.Header.Get("Authorization") == "Token t0k3n":
+				fmt.Fprintf(w, mockPrometheusMetrics, 1024)
+			case r.URL.Path == "/metrics":
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"code":"unauthorized","message":"unauthorized access"}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer ts.Close()
+		host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+		portNum, _ := strconv.ParseInt(port, 10, 64)
+		cfg := getMockConfig()
+		cfg["host"], cfg["port"] = host, portNum
+		cfg["source"], cfg["auth_method"], cfg["token"] = sourcePrometheus, authToken, "t0k3n"
+
+		mts, err := New().GetMetricTypes(cfg)
+		So(err, ShouldBeNil)
+		types := map[string]bool{}
+		for _, mt := range mts {
+			types[mt.Namespace.String()] = true
+		}
+		So(types["/intel/influxdb/prom/influxdb_info"], ShouldBeTrue)
+		So(types["/intel/influxdb/collector/ping/version"], ShouldBeTrue)
+
+		cfg["token"] = "other"
+		_, err = New().GetMetricTypes(cfg)
+		So(err, ShouldNotBeNil)
+		So(isAuthError(err), ShouldBeTrue)
+	})
+}
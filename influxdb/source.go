@@ -0,0 +1,216 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// source is a backend reading metrics of InfluxDB instances, e.g. the query "SHOW STATS" or endpoint /debug/vars;
+// sources are enabled per task in plugin config
+type source interface {
+	// Name returns name of the source used in plugin config and in metrics of collector
+	Name() string
+	// Requested tells if metrics read by the source are requested by `plan`
+	Requested(plan queryPlan) bool
+	// MetricTypes returns metrics exposed by InfluxDB instance `ep`, which are turned into metric types
+	MetricTypes(ctx context.Context, ep *endpoint) ([]plugin.Metric, error)
+	// Collect returns metrics of InfluxDB instance `ep` requested by `plan`
+	Collect(ctx context.Context, ep *endpoint, plan queryPlan) ([]plugin.Metric, error)
+}
+
+// prober is implemented by sources which gather no metrics of InfluxDB, their failures are only counted
+type prober interface {
+	probe() bool
+}
+
+// statsSource reads statistics with the query "SHOW STATS"
+type statsSource struct {
+	ic *influxdbCollector
+}
+
+func (s statsSource) Name() string { return sourceStats }
+
+func (s statsSource) Requested(plan queryPlan) bool { return plan.statistics }
+
+func (s statsSource) MetricTypes(ctx context.Context, ep *endpoint) ([]plugin.Metric, error) {
+	return s.ic.getStatistics(ctx, ep, nil)
+}
+
+func (s statsSource) Collect(ctx context.Context, ep *endpoint, plan queryPlan) ([]plugin.Metric, error) {
+	mts, err := s.ic.getStatistics(ctx, ep, plan.modules)
+	return withDerived(ep, plan, mts), err
+}
+
+// debugVarsSource reads statistics from endpoint /debug/vars
+type debugVarsSource struct {
+	ic *influxdbCollector
+}
+
+func (s debugVarsSource) Name() string { return sourceDebugVars }
+
+func (s debugVarsSource) Requested(plan queryPlan) bool { return plan.statistics }
+
+func (s debugVarsSource) MetricTypes(ctx context.Context, ep *endpoint) ([]plugin.Metric, error) {
+	return s.ic.queryDebugVars(ctx, ep, nil, s.ic.legacyNames(ep))
+}
+
+func (s debugVarsSource) Collect(ctx context.Context, ep *endpoint, plan queryPlan) ([]plugin.Metric, error) {
+	mts, err := s.ic.queryDebugVars(ctx, ep, plan.modules, s.ic.legacyNames(ep))
+	return withDerived(ep, plan, mts), err
+}
+
+// diagnosticsSource reads diagnostics with the query "SHOW DIAGNOSTICS"
+type diagnosticsSource struct {
+	ic *influxdbCollector
+}
+
+func (s diagnosticsSource) Name() string { return sourceDiagnostics }
+
+func (s diagnosticsSource) Requested(plan queryPlan) bool { return plan.diagnostics }
+
+func (s diagnosticsSource) MetricTypes(ctx context.Context, ep *endpoint) ([]plugin.Metric, error) {
+	return s.ic.getDiagnostics(ctx, ep)
+}
+
+func (s diagnosticsSource) Collect(ctx context.Context, ep *endpoint, plan queryPlan) ([]plugin.Metric, error) {
+	return s.ic.getDiagnostics(ctx, ep)
+}
+
+// prometheusSource reads metrics of InfluxDB 2.x from its Prometheus endpoint /metrics
+type prometheusSource struct {
+	ic *influxdbCollector
+}
+
+func (s prometheusSource) Name() string { return sourcePrometheus }
+
+func (s prometheusSource) Requested(plan queryPlan) bool { return plan.prometheus }
+
+func (s prometheusSource) MetricTypes(ctx context.Context, ep *endpoint) ([]plugin.Metric, error) {
+	return s.ic.queryPrometheus(ctx, ep)
+}
+
+func (s prometheusSource) Collect(ctx context.Context, ep *endpoint, plan queryPlan) ([]plugin.Metric, error) {
+	return s.ic.queryPrometheus(ctx, ep)
+}
+
+// pingSource probes InfluxDB instances with endpoint /ping, its results are reported by metrics of collector
+type pingSource struct {
+	ic *influxdbCollector
+}
+
+func (s pingSource) Name() string { return sourcePing }
+
+func (s pingSource) Requested(plan queryPlan) bool { return plan.collector }
+
+func (s pingSource) MetricTypes(ctx context.Context, ep *endpoint) ([]plugin.Metric, error) {
+	return s.ic.ping(ctx, ep)
+}
+
+func (s pingSource) Collect(ctx context.Context, ep *endpoint, plan queryPlan) ([]plugin.Metric, error) {
+	return s.ic.ping(ctx, ep)
+}
+
+func (s pingSource) probe() bool { return true }
+
+// withDerived returns statistics `mts` of InfluxDB instance `ep` with their rates and deltas when `plan` requests them
+func withDerived(ep *endpoint, plan queryPlan, mts []plugin.Metric) []plugin.Metric {
+	if len(mts) == 0 || !plan.derived {
+		return mts
+	}
+	return append(mts, ep.counters.derive(mts, time.Now(), ep.diagnostics.resetDetected())...)
+}
+
+// newSource returns source given by name `name`
+func (ic *influxdbCollector) newSource(name string) (source, error) {
+	switch name {
+	case sourceStats:
+		return statsSource{ic}, nil
+	case sourceDebugVars:
+		return debugVarsSource{ic}, nil
+	case sourceDiagnostics:
+		return diagnosticsSource{ic}, nil
+	case sourcePrometheus:
+		return prometheusSource{ic}, nil
+	case sourcePing:
+		return pingSource{ic}, nil
+	}
+	return nil, fmt.Errorf("Invalid source `%s`, must be one of: %s, %s, %s, %s, %s",
+		name, sourceStats, sourceDebugVars, sourceDiagnostics, sourcePrometheus, sourcePing)
+}
+
+// newSources returns sources given as a comma separated list `names`
+func (ic *influxdbCollector) newSources(names string) ([]source, error) {
+	sources := []source{}
+	enabled := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || enabled[name] {
+			continue
+		}
+		src, err := ic.newSource(name)
+		if err != nil {
+			return nil, err
+		}
+		enabled[name] = true
+		sources = append(sources, src)
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("Invalid list of sources `%s`, at least one source must be enabled", names)
+	}
+	// both sources expose statistics in the same namespace
+	if enabled[sourceStats] && enabled[sourceDebugVars] {
+		return nil, fmt.Errorf("Invalid list of sources `%s`, %s and %s cannot be enabled together", names, sourceStats, sourceDebugVars)
+	}
+	return sources, nil
+}
+
+// defaultSources returns names of sources enabled when they are not listed in plugin config:
+// statistics are read from `statsSource`, diagnostics are queried unless it is prometheus,
+// and instances are probed with /ping when `ping` is set
+func defaultSources(statsSource string, ping bool) string {
+	names := []string{}
+	if ping {
+		names = append(names, sourcePing)
+	}
+	if statsSource != sourcePrometheus {
+		names = append(names, sourceDiagnostics)
+	}
+	return strings.Join(append(names, statsSource), ",")
+}
+
+// enabledSources returns sources enabled in plugin config,
+// statistics and diagnostics are read with queries when the collector has not been initialized with config
+func (ic *influxdbCollector) enabledSources() []source {
+	if ic.sources == nil {
+		return []source{diagnosticsSource{ic}, statsSource{ic}}
+	}
+	return ic.sources
+}
+
+// sourceEnabled tells if source `name` is enabled
+func (ic *influxdbCollector) sourceEnabled(name string) bool {
+	for _, src := range ic.enabledSources() {
+		if src.Name() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newCountingMockCollector returns collector with mocked responses counting requests of each URL path
+func newCountingMockCollector() (*influxdbCollector, map[string]int) {
+	var mutex sync.Mutex
+	requests := map[string]int{}
+	ic := &influxdbCollector{
+		getResponse: func(ctx context.Context, url string) ([]byte, error) {
+			mutex.Lock()
+			requests[strings.SplitN(url, "?", 2)[0]]++
+			mutex.Unlock()
+			return getMockHTTPResponse(ctx, url)
+		},
+		endpoints: []*endpoint{newMockEndpoint("stats", "diagnostics")},
+	}
+	return ic, requests
+}
+
+func TestSources(t *testing.T) {
+	Convey("Creating sources", t, func() {
+		ic := &influxdbCollector{}
+		names := func(sources []source) []string {
+			res := []string{}
+			for _, src := range sources {
+				res = append(res, src.Name())
+			}
+			return res
+		}
+
+		Convey("from a list of names", func() {
+			sources, err := ic.newSources(" prometheus, ping,prometheus ")
+			So(err, ShouldBeNil)
+			So(names(sources), ShouldResemble, []string{sourcePrometheus, sourcePing})
+		})
+		Convey("by default from source of statistics and ping", func() {
+			So(defaultSources(sourceStats, true), ShouldEqual, "ping,diagnostics,stats")
+			So(defaultSources(sourceDebugVars, false), ShouldEqual, "diagnostics,debug_vars")
+			So(defaultSources(sourcePrometheus, true), ShouldEqual, "ping,prometheus")
+		})
+		Convey("failing for unknown source", func() {
+			_, err := ic.newSources("stats,expvar")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Invalid source `expvar`")
+		})
+		Convey("failing for empty list", func() {
+			_, err := ic.newSources(" , ")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("failing for sources exposing the same statistics", func() {
+			_, err := ic.newSources("stats,debug_vars")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "cannot be enabled together")
+		})
+		Convey("reading statistics and diagnostics with queries when not configured", func() {
+			So(names(ic.enabledSources()), ShouldResemble, []string{sourceDiagnostics, sourceStats})
+			So(ic.sourceEnabled(sourcePing), ShouldBeFalse)
+		})
+	})
+
+	Convey("Sources tell if their metrics are requested", t, func() {
+		ic := &influxdbCollector{}
+		plan := newQueryPlan([]plugin.Metric{{Namespace: plugin.NewNamespace("intel", "influxdb", "diagn", "system", "PID")}}, false)
+		So(diagnosticsSource{ic}.Requested(plan), ShouldBeTrue)
+		So(statsSource{ic}.Requested(plan), ShouldBeFalse)
+		So(prometheusSource{ic}.Requested(plan), ShouldBeFalse)
+		So(pingSource{ic}.Requested(plan), ShouldBeFalse)
+
+		plan = newQueryPlan([]plugin.Metric{{Namespace: plugin.NewNamespace("intel", "influxdb", "prom", "*")}}, true)
+		So(prometheusSource{ic}.Requested(plan), ShouldBeTrue)
+		So(debugVarsSource{ic}.Requested(plan), ShouldBeFalse)
+
+		plan = newQueryPlan([]plugin.Metric{{Namespace: plugin.NewNamespace("intel", "influxdb", "collector", "up")}}, true)
+		for _, src := range []source{statsSource{ic}, debugVarsSource{ic}, prometheusSource{ic}, pingSource{ic}} {
+			So(src.Requested(plan), ShouldBeTrue)
+		}
+	})
+
+	Convey("Collecting metrics from a single source", t, func() {
+		ic, requests := newCountingMockCollector()
+		src := statsSource{ic}
+		ep := ic.endpoints[0]
+		plan := newQueryPlan([]plugin.Metric{{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "*", "rate")}}, true)
+
+		Convey("returns statistics with their rates and deltas", func() {
+			_, err := src.Collect(context.Background(), ep, plan)
+			So(err, ShouldBeNil)
+			mts, err := src.Collect(context.Background(), ep, plan)
+			So(err, ShouldBeNil)
+			namespaces := map[string]bool{}
+			for _, mt := range mts {
+				namespaces[mt.Namespace.String()] = true
+			}
+			So(namespaces["/intel/influxdb/stat/httpd/req"], ShouldBeTrue)
+			So(namespaces["/intel/influxdb/stat/httpd/req/rate"], ShouldBeTrue)
+			So(requests["stats"], ShouldEqual, 2)
+		})
+		Convey("exposes metric types without changing samples of counters", func() {
+			mts, err := src.MetricTypes(context.Background(), ep)
+			So(err, ShouldBeNil)
+			So(mts, ShouldNotBeEmpty)
+			mts, err = src.Collect(context.Background(), ep, plan)
+			So(err, ShouldBeNil)
+			for _, mt := range mts {
+				So(isDerived(mt.Namespace), ShouldBeFalse)
+			}
+		})
+	})
+
+	Convey("Collecting metrics from sources enabled in plugin config", t, func() {
+		ic, requests := newCountingMockCollector()
+		cfg := getMockConfig()
+		cfg["ping"] = false
+		mts := []plugin.Metric{
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "diagn", "system", "PID")},
+			{Namespace: plugin.NewNamespace("intel", "influxdb", "stat", "httpd", "req")},
+		}
+		collect := func(sources string) map[string]bool {
+			cfg["sources"] = sources
+			So(ic.init(cfg), ShouldBeNil)
+			ic.endpoints = []*endpoint{newMockEndpoint("stats", "diagnostics")}
+			for path := range requests {
+				delete(requests, path)
+			}
+			results, err := ic.CollectMetrics(mts)
+			So(err, ShouldBeNil)
+			namespaces := map[string]bool{}
+			for _, mt := range results {
+				namespaces[mt.Namespace.String()] = true
+			}
+			return namespaces
+		}
+
+		Convey("queries only enabled sources", func() {
+			namespaces := collect("stats")
+			So(namespaces["/intel/influxdb/stat/httpd/req"], ShouldBeTrue)
+			So(namespaces["/intel/influxdb/diagn/system/PID"], ShouldBeFalse)
+
+			namespaces = collect("diagnostics")
+			So(namespaces["/intel/influxdb/stat/httpd/req"], ShouldBeFalse)
+			So(namespaces["/intel/influxdb/diagn/system/PID"], ShouldBeTrue)
+			So(requests["stats"], ShouldEqual, 0)
+		})
+		Convey("discovers metric types of enabled sources", func() {
+			collect("diagnostics")
+			types, err := ic.GetMetricTypes(cfg)
+			So(err, ShouldBeNil)
+			for _, mt := range types {
+				So(mt.Namespace.Strings()[2], ShouldNotEqual, nsTypeStats)
+			}
+		})
+		Convey("fails for invalid list of sources", func() {
+			cfg["sources"] = "stats,debug_vars"
+			So(ic.init(cfg), ShouldNotBeNil)
+		})
+	})
+}
@@ -2,11 +2,29 @@ package influxdb
 
 type stats struct {
 	Results []struct {
-		Series []struct {
-			Name    string            `json:"name"`
-			Columns []string          `json:"columns"`
-			Values  [][]int           `json:"values"`
-			Tags    map[string]string `json:"tags,omitempty"`
-		} `json:"series"`
+		Series []statsSeries `json:"series"`
+		Error  string        `json:"error,omitempty"`
 	} `json:"results"`
+	Error string `json:"error,omitempty"`
+}
+
+// statsSeries holds statistics of a single module of InfluxDB, e.g. of one shard
+type statsSeries struct {
+	Name    string            `json:"name"`
+	Columns []string          `json:"columns"`
+	Values  [][]interface{}   `json:"values"`
+	Tags    map[string]string `json:"tags,omitempty"`
+}
+
+// err returns error reported by InfluxDB for the query or any of its statements
+func (s stats) err() error {
+	if s.Error != "" {
+		return &queryError{message: s.Error}
+	}
+	for _, result := range s.Results {
+		if result.Error != "" {
+			return &queryError{message: result.Error}
+		}
+	}
+	return nil
 }
@@ -0,0 +1,49 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+Copyright 2016 Intel Corporation
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// decodeResponse unmarshals JSON `data` into `v` keeping numbers as json.Number,
+// so that they can be converted by typedValue without loss of precision
+func decodeResponse(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// typedValue converts value decoded by decodeResponse into the Go type determining data type of Snap metric:
+// integers into int64 (or uint64 when they exceed int64 range), other numbers into float64,
+// strings and booleans are returned unchanged
+func typedValue(v interface{}) interface{} {
+	number, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := number.Int64(); err == nil {
+		return i
+	}
+	if u, err := strconv.ParseUint(number.String(), 10, 64); err == nil {
+		return u
+	}
+	if f, err := number.Float64(); err == nil {
+		return f
+	}
+	return number.String()
+}